@@ -0,0 +1,171 @@
+package seeker
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/internal/dbhandlers"
+	aplugin "github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
+	"github.com/malcolmmadsheep/handshakes-seeker/plugins"
+)
+
+// The same graph in every format: a chain a-b-c-d-e, a dead end a-x-y, and z
+// that links to a but isn't linked to.
+var graphFiles = []struct {
+	name    string
+	content string
+	// label is the GraphML key naming nodes.
+	label string
+}{
+	{"graph.csv", "source,target\na,b\na,x\nb,c\nc,d\nd,e\nx,y\nz,a\n", ""},
+	{"graph.tsv", "source\ttarget\na\tb\na\tx\nb\tc\nc\td\nd\te\nx\ty\nz\ta\n", ""},
+	{"graph.json", `{"a": ["b", "x"], "b": ["c"], "c": ["d"], "d": ["e"], "e": [], "x": ["y"], "y": [], "z": ["a"]}`, ""},
+	{"graph.graphml", `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="name" for="node" attr.name="name" attr.type="string"/>
+  <graph edgedefault="directed">
+    <node id="n0"><data key="name">a</data></node>
+    <node id="n1"><data key="name">b</data></node>
+    <node id="n2"><data key="name">c</data></node>
+    <node id="n3"><data key="name">d</data></node>
+    <node id="n4"><data key="name">e</data></node>
+    <node id="x"/>
+    <node id="y"/>
+    <node id="z"/>
+    <edge source="n0" target="n1"/>
+    <edge source="n0" target="x"/>
+    <edge source="n1" target="n2"/>
+    <edge source="n2" target="n3"/>
+    <edge source="n3" target="n4"/>
+    <edge source="x" target="y"/>
+    <edge source="z" target="n0"/>
+  </graph>
+</graphml>`, "name"},
+}
+
+func newGraphFilePlugin(t *testing.T, name, content, label string) *plugins.GraphFilePlugin {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := plugins.NewGraphFilePlugin(plugins.GraphFileConfig{
+		Name:         "graph",
+		Path:         path,
+		Header:       true,
+		SourceColumn: "source",
+		TargetColumn: "target",
+		Label:        label,
+		// Links of a are split across pages.
+		PageSize: 1,
+		Queue: plugins.QueueConfig{
+			QueueSize: 10,
+			Workers:   2,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewGraphFilePlugin: %s", err)
+	}
+
+	return p
+}
+
+// backlinksCounter counts backlinks requests of the plugin it wraps.
+type backlinksCounter struct {
+	*plugins.GraphFilePlugin
+	requests int32
+}
+
+func (p *backlinksCounter) DoBacklinksRequest(req aplugin.Request) (*aplugin.Response, error) {
+	atomic.AddInt32(&p.requests, 1)
+	return p.GraphFilePlugin.DoBacklinksRequest(req)
+}
+
+func TestSeekerSearchesGraphFiles(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		dest       string
+		maxDepth   int
+		wantStatus services.PathStatus
+		wantTrace  string
+		// wantMeet tells that the search from dest is needed, as either end
+		// goes only 2 hops.
+		wantMeet bool
+	}{
+		{"found", "a", "e", 0, services.PathStatusFound, "a,b,c,d,e", false},
+		{"met within max depth", "a", "e", 4, services.PathStatusFound, "a,b,c,d,e", true},
+		{"beyond max depth", "a", "e", 3, services.PathStatusNotFound, "", false},
+		{"found from the middle", "z", "c", 0, services.PathStatusFound, "z,a,b,c", false},
+		{"not linked to", "a", "z", 0, services.PathStatusNotFound, "", false},
+		{"dead end", "x", "e", 0, services.PathStatusNotFound, "", false},
+	}
+
+	for _, file := range graphFiles {
+		t.Run(file.name, func(t *testing.T) {
+			for _, test := range tests {
+				t.Run(test.name, func(t *testing.T) {
+					p := &backlinksCounter{GraphFilePlugin: newGraphFilePlugin(t, file.name, file.content, file.label)}
+					s := startTestSeeker(t, p)
+
+					taskId := s.startSearch(t, dbhandlers.CreateTaskReq{
+						SourceUrl:  test.source,
+						DestUrl:    test.dest,
+						DataSource: "graph",
+						MaxDepth:   test.maxDepth,
+					})
+					path := s.waitForPath(t, taskId)
+
+					if path.Status != test.wantStatus.String() {
+						t.Fatalf("status = %s, want %s", path.Status, test.wantStatus)
+					}
+					if path.Trace != test.wantTrace {
+						t.Errorf("trace = %q, want %q", path.Trace, test.wantTrace)
+					}
+					if test.wantMeet && atomic.LoadInt32(&p.requests) == 0 {
+						t.Error("found without searching from dest")
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestSeekerSearchesUndirectedGraphFile(t *testing.T) {
+	graphML := `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <graph edgedefault="undirected">
+    <edge source="a" target="b"/>
+    <edge source="c" target="b"/>
+    <edge source="c" target="d" directed="true"/>
+  </graph>
+</graphml>`
+
+	tests := []struct {
+		source, dest string
+		wantStatus   services.PathStatus
+		wantTrace    string
+	}{
+		{"a", "d", services.PathStatusFound, "a,b,c,d"},
+		{"c", "a", services.PathStatusFound, "c,b,a"},
+		{"d", "a", services.PathStatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source+"-"+test.dest, func(t *testing.T) {
+			s := startTestSeeker(t, newGraphFilePlugin(t, "graph.graphml", graphML, ""))
+
+			taskId := s.startSearch(t, dbhandlers.CreateTaskReq{SourceUrl: test.source, DestUrl: test.dest, DataSource: "graph"})
+			path := s.waitForPath(t, taskId)
+
+			if path.Status != test.wantStatus.String() || path.Trace != test.wantTrace {
+				t.Errorf("%s, %q, want %s, %q", path.Status, path.Trace, test.wantStatus, test.wantTrace)
+			}
+		})
+	}
+}
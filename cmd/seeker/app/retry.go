@@ -0,0 +1,68 @@
+package seeker
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultMaxAttempts    = 5
+	defaultRetryBaseDelay = time.Second
+	defaultRetryMaxDelay  = time.Minute
+)
+
+// RetryPolicy decides how tasks whose plugin request failed are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a task is tried before it's moved to
+	// dead letters.
+	MaxAttempts int
+	// BaseDelay is the backoff after the first failure, it doubles with every
+	// next one up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultMaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaultRetryBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaultRetryMaxDelay
+	}
+	if p.MaxDelay < p.BaseDelay {
+		p.MaxDelay = p.BaseDelay
+	}
+
+	return p
+}
+
+// Backoff returns the delay before the next try of a task that has already
+// failed the given number of times. The delay is picked at random between half
+// and the full exponential backoff, so retries of tasks failed together
+// spread out.
+func (p RetryPolicy) Backoff(failures int) time.Duration {
+	delay := p.MaxDelay
+	if failures < 32 {
+		if d := p.BaseDelay << uint(failures); d > 0 && d < p.MaxDelay {
+			delay = d
+		}
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// requestError is a failed plugin request, it's handled by the retry policy.
+type requestError struct {
+	err error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -24,10 +27,59 @@ type Seeker struct {
 	handlers    *ahandlers.Handlers
 	taskService services.TaskService
 	pathService services.PathService
+	deadLetters services.DeadLetterService
+	strategies  map[string]SearchStrategy
 	errorLogger *log.Logger
+
+	shutdownCtx context.Context
+	queues      map[string]aqueue.Queue
+	limiters    map[string]*aqueue.Limiter
+	producers   sync.WaitGroup
+	consumers   sync.WaitGroup
+}
+
+const defaultShutdownTimeout = 15 * time.Second
+
+const defaultLeaseDuration = 5 * time.Minute
+
+const defaultPollInterval = 5 * time.Second
+
+type Config struct {
+	// ShutdownTimeout bounds the time spent on draining HTTP connections and
+	// finishing tasks being processed.
+	ShutdownTimeout time.Duration
+	// InstanceId identifies the instance leasing tasks. It has to be unique
+	// among instances sharing the same database.
+	InstanceId string
+	// LeaseDuration is the time a claimed task stays invisible to other
+	// instances. It should cover the time a task spends in the queue and in
+	// processing.
+	LeaseDuration time.Duration
+	// NewQueue creates the queue passing tasks of a plugin from its producer
+	// to its consumer. Defaults to an in-memory aqueue.ChannelQueue.
+	NewQueue QueueFactory
+	// Retry decides how tasks whose plugin request failed are retried.
+	Retry RetryPolicy
+	// PollInterval is the time a producer waits before looking for tasks of
+	// its plugin again once there are none.
+	PollInterval time.Duration
 }
 
-type Config struct{}
+// QueueFactory creates the queue of tasks of the named plugin.
+type QueueFactory func(name string, config aqueue.Config) aqueue.Queue
+
+func newChannelQueue(name string, config aqueue.Config) aqueue.Queue {
+	return aqueue.NewChannelQueue(config)
+}
+
+func defaultInstanceId() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "seeker"
+	}
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
 
 func New(
 	shutdownCtx context.Context,
@@ -35,6 +87,7 @@ func New(
 	handlers ahandlers.Handlers,
 	taskService services.TaskService,
 	pathService services.PathService,
+	deadLetters services.DeadLetterService,
 	plugins []aplugin.Plugin,
 ) (*Seeker, error) {
 	if len(plugins) == 0 {
@@ -43,13 +96,40 @@ func New(
 
 	errorLogger := log.New(os.Stdout, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
 
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = defaultShutdownTimeout
+	}
+	if cfg.InstanceId == "" {
+		cfg.InstanceId = defaultInstanceId()
+	}
+	if cfg.LeaseDuration <= 0 {
+		cfg.LeaseDuration = defaultLeaseDuration
+	}
+	if cfg.NewQueue == nil {
+		cfg.NewQueue = newChannelQueue
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	cfg.Retry = cfg.Retry.withDefaults()
+
+	strategies := make(map[string]SearchStrategy, len(plugins))
+	for _, plugin := range plugins {
+		strategies[plugin.GetName()] = newStrategy(plugin, taskService, pathService)
+	}
+
 	return &Seeker{
-		cfg,
-		plugins,
-		&handlers,
-		taskService,
-		pathService,
-		errorLogger,
+		cfg:         cfg,
+		plugins:     plugins,
+		handlers:    &handlers,
+		taskService: taskService,
+		pathService: pathService,
+		deadLetters: deadLetters,
+		strategies:  strategies,
+		errorLogger: errorLogger,
+		shutdownCtx: shutdownCtx,
+		queues:      make(map[string]aqueue.Queue, len(plugins)),
+		limiters:    make(map[string]*aqueue.Limiter, len(plugins)),
 	}, nil
 }
 
@@ -73,42 +153,92 @@ func queueTaskToTask(queueTask aqueue.Task) (*services.Task, error) {
 	return &task, nil
 }
 
+// GetTasks claims tasks of the plugin, i.e. tasks whose data source is the
+// plugin name.
 func (s *Seeker) GetTasks(pluginName string, n uint) ([]*services.Task, error) {
-	return s.taskService.GetNEarliestTasks(n)
+	return s.taskService.ClaimNEarliestTasks(s.cfg.InstanceId, pluginName, n, s.cfg.LeaseDuration)
 }
 
-func (s *Seeker) shouldSkipTask(task *services.Task) bool {
+// postponeDelay is the time a task of a search that looks cancelled waits
+// before it's checked again.
+const postponeDelay = 5 * time.Second
+
+// errTaskPostponed is returned for tasks of searches whose requests count
+// says everybody cancelled them while their path is still in progress. The
+// count may be stale, e.g. cached by this instance before the search was
+// resubmitted through another one, so such tasks are left in the queue rather
+// than deleted and their search isn't finished.
+var errTaskPostponed = errors.New("task postponed")
+
+// skipTask reports whether the search of the task is over or was restarted
+// since the task was created, so the task is dropped without being expanded.
+// It returns errTaskPostponed if the task has to be checked again later.
+func (s *Seeker) skipTask(task *services.Task) (bool, error) {
+	path, err := s.pathService.GetPathByTaskId(task.OriginTaskId)
+	if err != nil && err != pgx.ErrNoRows {
+		s.errorLogger.Println("seeker:s.pathService.GetPathByTaskId:", err)
+	}
+
+	if err == nil && (path.Status == services.PathStatusFound.String() ||
+		path.Status == services.PathStatusNotFound.String() ||
+		path.Status == services.PathStatusCancelled.String()) {
+		return true, nil
+	}
+	if err == nil && path.Generation != task.Generation {
+		return true, nil
+	}
+
 	if s.taskService.ShouldSkipTask(task) {
-		return true
+		return false, errTaskPostponed
 	}
 
-	path, err := s.pathService.GetPathByTaskId(task.OriginTaskId)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			return false
-		}
-		s.errorLogger.Println("seeker:s.pathService.GetPathByTaskId:", err)
+	return false, nil
+}
+
+// sleep pauses for d and reports whether ctx is still alive afterwards.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
 		return false
+	case <-time.After(d):
+		return true
 	}
-
-	return path.Status == services.PathStatusFound.String() || path.Status == services.PathStatusNotFound.String()
 }
 
-func (s *Seeker) startQueues() {
+// startQueues starts a producer pulling tasks into a queue and a pool of
+// consumers processing them for every plugin. Producers stop pulling once ctx is done,
+// consumers run until their queue stops consuming. A task is deleted and acked
+// only after it's processed and its results are stored, otherwise it's nacked
+// to be delivered again. Queues and limiters of all plugins are created before
+// any goroutine starts, as consumers read them.
+func (s *Seeker) startQueues(ctx context.Context) {
 	for _, plugin := range s.plugins {
-		queue := aqueue.New(plugin.GetQueueConfig())
+		queueConfig := plugin.GetQueueConfig()
+		limiter := queueConfig.Limiter()
+		s.limiters[plugin.GetName()] = limiter
+		s.queues[plugin.GetName()] = aqueue.NewLimitedQueue(s.cfg.NewQueue(plugin.GetName(), queueConfig), limiter)
+	}
+
+	for _, plugin := range s.plugins {
+		queueConfig := plugin.GetQueueConfig()
+		queue := s.queues[plugin.GetName()]
 
 		consumeTaskCh := queue.StartConsuming(context.Background())
-		go func(p aplugin.Plugin, q *aqueue.Queue) {
-			for {
+
+		s.producers.Add(1)
+		go func(p aplugin.Plugin, q aqueue.Queue) {
+			defer s.producers.Done()
+
+			for ctx.Err() == nil {
 				tasks, err := s.GetTasks(p.GetName(), p.GetQueueConfig().QueueSize)
 				if err != nil {
 					s.errorLogger.Printf("GetTasks: %s\n", err)
+					sleep(ctx, time.Second)
 					continue
 				}
 
 				if len(tasks) == 0 {
-					time.Sleep(5 * time.Second)
+					sleep(ctx, s.cfg.PollInterval)
 					continue
 				}
 
@@ -118,92 +248,422 @@ func (s *Seeker) startQueues() {
 						s.errorLogger.Printf("taskToQueueTask: %s\n", err)
 						continue
 					}
-					queue.Publish(queueTask)
 
-					err = s.taskService.DeleteTaskByIds(task.Id, task.OriginTaskId)
+					err = q.Publish(ctx, queueTask)
 					if err != nil {
-						s.errorLogger.Printf("DeleteTaskById: %s; %s\n", task.Id, err)
+						break
 					}
 				}
 			}
-		}(plugin, &queue)
+		}(plugin, queue)
 
-		go func(p aplugin.Plugin, consumeTaskCh <-chan aqueue.Task) {
-			for queueTask := range consumeTaskCh {
-				task, err := queueTaskToTask(queueTask)
-				if err != nil {
-					s.errorLogger.Printf("queueTaskToTask: %s\n", err)
-					continue
-				}
+		workers := queueConfig.Workers
+		if workers == 0 {
+			workers = 1
+		}
 
-				if s.shouldSkipTask(task) {
-					continue
-				}
+		batchPlugin, canBatch := aplugin.AsBatchPlugin(plugin)
 
-				request := aplugin.Request{
-					SourceUrl: task.SourceUrl,
-					DestUrl:   task.DestUrl,
-					Cursor:    task.Cursor,
-				}
+		for i := uint(0); i < workers; i++ {
+			s.consumers.Add(1)
 
-				response, err := p.DoRequest(request)
-				if err != nil {
-					s.errorLogger.Printf("DoRequest. Plugin: %s; Error: %s\n", p.GetName(), err)
-					continue
-				}
+			if canBatch {
+				go func(p aplugin.BatchPlugin, strategy SearchStrategy, consumeTaskCh <-chan *aqueue.Delivery) {
+					defer s.consumers.Done()
 
-				var foundConnection *aplugin.Connection
-
-				for _, connection := range response.Connections {
-					_, err := s.taskService.CreateNewTask(
-						s.taskService.GenerateId(connection.SourceUrl, connection.DestUrl),
-						task.OriginTaskId,
-						connection.SourceUrl,
-						connection.DestUrl,
-						connection.Cursor,
-						task.RequestsCount,
-					)
-					if err != nil {
-						s.errorLogger.Printf("s.taskService.CreateNewTask. Plugin: %s; Error: %s\n", p.GetName(), err)
-						continue
+					batchSize := batchSize(p)
+					for delivery := range consumeTaskCh {
+						s.consumeBatch(p, strategy, collectBatch(delivery, consumeTaskCh, batchSize))
 					}
+				}(batchPlugin, s.strategies[plugin.GetName()], consumeTaskCh)
+				continue
+			}
 
-					_, err = s.pathService.CreateFoundPath(
-						s.taskService.GenerateId(task.SourceUrl, connection.SourceUrl),
-						task.SourceUrl,
-						connection.SourceUrl,
-						fmt.Sprintf("%s,%s", task.SourceUrl, connection.SourceUrl),
-					)
-					if err != nil {
-						s.errorLogger.Printf("s.pathService.CreateFoundPath. Plugin: %s; Error: %s\n", p.GetName(), err)
-						continue
-					}
+			go func(p aplugin.Plugin, strategy SearchStrategy, consumeTaskCh <-chan *aqueue.Delivery) {
+				defer s.consumers.Done()
 
-					if connection.SourceUrl == connection.DestUrl {
-						foundConnection = &connection
-						break
-					}
+				for delivery := range consumeTaskCh {
+					s.consumeTask(p, strategy, delivery)
 				}
+			}(plugin, s.strategies[plugin.GetName()], consumeTaskCh)
+		}
+	}
+}
 
-				if foundConnection != nil {
-					fmt.Println("Success found path:", task.Id, foundConnection)
-					err = s.taskService.DeleteAllTasksWithOrigin(task.OriginTaskId)
-					if err != nil {
-						s.errorLogger.Printf("taskService.DeleteAllTasksWithOrigin. Plugin: %s; Error: %s\n", p.GetName(), err)
-					}
+// batchLinger is the time a batch waits for more tasks to join it.
+const batchLinger = 20 * time.Millisecond
 
-					err = s.pathService.UpdatePathStatusByTaskId(task.OriginTaskId, services.PathStatusFound)
-					if err != nil {
-						s.errorLogger.Printf("pathService.UpdatePathStatusByTaskId. Plugin: %s; Error: %s\n", p.GetName(), err)
-					}
-					continue
-				}
+// batchSize returns the number of tasks expanded with a batch request of p.
+func batchSize(p aplugin.BatchPlugin) int {
+	size := aplugin.GetCapabilities(p).BatchSize
+	if size <= 0 {
+		size = int(p.GetQueueConfig().QueueSize)
+	}
+	if size <= 0 {
+		size = 1
+	}
+
+	return size
+}
+
+// collectBatch adds deliveries arriving within batchLinger to the first one,
+// up to size of them. Batches are limited by the concurrency of the queue as
+// well, as every delivery holds a slot until it's acked.
+func collectBatch(first *aqueue.Delivery, consumeTaskCh <-chan *aqueue.Delivery, size int) []*aqueue.Delivery {
+	deliveries := make([]*aqueue.Delivery, 0, size)
+	deliveries = append(deliveries, first)
+
+	linger := time.NewTimer(batchLinger)
+	defer linger.Stop()
+
+	for len(deliveries) < size {
+		select {
+		case delivery, ok := <-consumeTaskCh:
+			if !ok {
+				return deliveries
+			}
+			deliveries = append(deliveries, delivery)
+		case <-linger.C:
+			return deliveries
+		}
+	}
+
+	return deliveries
+}
+
+// stopQueues waits for producers to stop, lets consumers finish tasks being
+// processed and releases leases of tasks left in the in-memory queues, so
+// they are picked up by other instances or after restart.
+func (s *Seeker) stopQueues(ctx context.Context) {
+	if !waitGroupWithContext(ctx, &s.producers) {
+		s.errorLogger.Println("stopQueues: producers didn't stop in time")
+	}
+
+	for _, queue := range s.queues {
+		queue.StopConsuming()
+	}
+
+	if !waitGroupWithContext(ctx, &s.consumers) {
+		s.errorLogger.Println("stopQueues: consumers didn't finish in time, tasks being processed are lost")
+	}
+
+	for _, queue := range s.queues {
+		queue.Drain()
+	}
+
+	err := s.taskService.ReleaseTasks(s.cfg.InstanceId)
+	if err != nil {
+		s.errorLogger.Printf("taskService.ReleaseTasks: %s\n", err)
+	}
+}
+
+// closePlugins closes plugins holding resources, e.g. processes, once no
+// tasks are processed anymore.
+func (s *Seeker) closePlugins() {
+	for _, plugin := range s.plugins {
+		closer, ok := plugin.(io.Closer)
+		if !ok {
+			continue
+		}
+
+		err := closer.Close()
+		if err != nil {
+			s.errorLogger.Printf("closing plugin %s: %s\n", plugin.GetName(), err)
+		}
+	}
+}
+
+func (s *Seeker) consumeTask(p aplugin.Plugin, strategy SearchStrategy, delivery *aqueue.Delivery) {
+	task, err := queueTaskToTask(delivery.Task)
+	if err != nil {
+		s.errorLogger.Printf("queueTaskToTask: %s\n", err)
+		s.ackTask(p, delivery)
+		return
+	}
+
+	err = s.processTask(p, strategy, task)
+	s.completeTask(p, task, delivery, err)
+}
+
+// consumeBatch expands tasks of the deliveries with a single batch request.
+// Tasks are completed one by one, so a failed request only retries its own
+// task.
+func (s *Seeker) consumeBatch(p aplugin.BatchPlugin, strategy SearchStrategy, deliveries []*aqueue.Delivery) {
+	_, canGoBackward := aplugin.AsBacklinksPlugin(p)
+
+	tasks := make([]*services.Task, 0, len(deliveries))
+	batched := make([]*aqueue.Delivery, 0, len(deliveries))
+	requests := make([]aplugin.BatchRequest, 0, len(deliveries))
+
+	for _, delivery := range deliveries {
+		task, err := queueTaskToTask(delivery.Task)
+		if err != nil {
+			s.errorLogger.Printf("queueTaskToTask: %s\n", err)
+			s.ackTask(p, delivery)
+			continue
+		}
+
+		backward := task.Direction == services.TaskDirectionBackward
+		skip, err := s.skipTask(task)
+		if skip || err != nil || (backward && !canGoBackward) {
+			s.completeTask(p, task, delivery, err)
+			continue
+		}
+
+		tasks = append(tasks, task)
+		batched = append(batched, delivery)
+		requests = append(requests, aplugin.BatchRequest{
+			Request:  taskRequest(task),
+			Backward: backward,
+		})
+	}
+
+	if len(requests) == 0 {
+		return
+	}
+
+	results, batchErr := p.DoBatchRequest(requests)
+	if batchErr == nil && len(results) != len(requests) {
+		batchErr = fmt.Errorf("batch of %d requests got %d results", len(requests), len(results))
+	}
+
+	for i, task := range tasks {
+		err := batchErr
+		if err == nil {
+			err = results[i].Err
+		}
+
+		var expansion *Expansion
+		if err == nil {
+			response := results[i].Response
+			if response == nil {
+				response = &aplugin.Response{}
+			}
+
+			expansion, err = strategy.ExpandResponse(p, task, response)
+		}
+
+		if err != nil {
+			s.errorLogger.Printf("DoBatchRequest. Plugin: %s; Error: %s\n", p.GetName(), err)
+			err = &requestError{err}
+		} else {
+			err = s.storeExpansion(p, task, expansion)
+		}
+
+		s.completeTask(p, task, batched[i], err)
+	}
+}
+
+// completeTask acks the delivery of a processed task. A task whose request
+// failed is retried, a postponed task is returned to the queue, other
+// failures nack the delivery, so it's delivered again.
+func (s *Seeker) completeTask(p aplugin.Plugin, task *services.Task, delivery *aqueue.Delivery, err error) {
+	if errors.Is(err, errTaskPostponed) {
+		s.postponeTask(p, task, delivery)
+		return
+	}
+
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		err = s.retryTask(p, task, reqErr.err)
+	} else if err == nil {
+		err = s.taskService.DeleteTaskByIds(task.Id, task.OriginTaskId, task.Generation)
+		if err != nil {
+			s.errorLogger.Printf("DeleteTaskById: %s; %s\n", task.Id, err)
+		}
+	}
+	if err != nil {
+		err = delivery.Nack()
+		if err != nil {
+			s.errorLogger.Printf("delivery.Nack. Plugin: %s; Error: %s\n", p.GetName(), err)
+		}
+		return
+	}
+
+	s.finishTask(p, task)
+	s.ackTask(p, delivery)
+}
+
+// postponeTask leaves the task in the queue to be claimed after
+// postponeDelay. Its search isn't finished, as the task is still there.
+func (s *Seeker) postponeTask(p aplugin.Plugin, task *services.Task, delivery *aqueue.Delivery) {
+	err := s.taskService.PostponeTask(task.Id, postponeDelay)
+	if err != nil {
+		s.errorLogger.Printf("taskService.PostponeTask. Plugin: %s; Error: %s\n", p.GetName(), err)
+
+		err = delivery.Nack()
+		if err != nil {
+			s.errorLogger.Printf("delivery.Nack. Plugin: %s; Error: %s\n", p.GetName(), err)
+		}
+		return
+	}
+
+	s.ackTask(p, delivery)
+}
+
+// retryTask schedules the task whose plugin request failed to be tried again
+// after a backoff. Once the failure is permanent or the task is out of
+// attempts, the task is moved to dead letters. If the plugin was asked to slow
+// down, its whole queue backs off.
+func (s *Seeker) retryTask(p aplugin.Plugin, task *services.Task, cause error) error {
+	delay := s.cfg.Retry.Backoff(task.Attempts)
+
+	if after, ok := aplugin.GetRetryAfter(cause); ok {
+		s.limiters[p.GetName()].Pause(after)
+		if after > delay {
+			delay = after
+		}
+	}
+
+	if aplugin.IsRetryable(cause) && task.Attempts+1 < s.cfg.Retry.MaxAttempts {
+		err := s.taskService.RetryTask(task.Id, delay)
+		if err != nil {
+			s.errorLogger.Printf("taskService.RetryTask. Plugin: %s; Error: %s\n", p.GetName(), err)
+		}
+		return err
+	}
+
+	task.Attempts++
+
+	_, err := s.deadLetters.CreateDeadLetter(task, cause.Error())
+	if err != nil {
+		s.errorLogger.Printf("deadLetters.CreateDeadLetter. Plugin: %s; Error: %s\n", p.GetName(), err)
+		return err
+	}
+
+	err = s.taskService.DeleteTaskByIds(task.Id, task.OriginTaskId, task.Generation)
+	if err != nil {
+		s.errorLogger.Printf("DeleteTaskById: %s; %s\n", task.Id, err)
+	}
+
+	return err
+}
+
+func (s *Seeker) ackTask(p aplugin.Plugin, delivery *aqueue.Delivery) {
+	err := delivery.Ack()
+	if err != nil {
+		s.errorLogger.Printf("delivery.Ack. Plugin: %s; Error: %s\n", p.GetName(), err)
+	}
+}
+
+func waitGroupWithContext(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// processTask expands the task and stores the outcome. It returns an error if
+// the task has to be processed again.
+func (s *Seeker) processTask(p aplugin.Plugin, strategy SearchStrategy, task *services.Task) error {
+	skip, err := s.skipTask(task)
+	if skip || err != nil {
+		return err
+	}
+
+	expansion, err := strategy.Expand(p, task)
+	if err != nil {
+		s.errorLogger.Printf("DoRequest. Plugin: %s; Error: %s\n", p.GetName(), err)
+		return &requestError{err}
+	}
+
+	return s.storeExpansion(p, task, expansion)
+}
+
+// storeExpansion stores the outcome of an expanded task. It returns an error
+// if the task has to be processed again. The outcome is dropped if the search
+// ended or was restarted while the task was expanded, as edges of the earlier
+// run would break traces of the new one.
+func (s *Seeker) storeExpansion(p aplugin.Plugin, task *services.Task, expansion *Expansion) error {
+	err := s.pathService.BulkCreateFoundPaths(expansion.Edges)
+	if errors.Is(err, services.ErrStaleSearch) {
+		return nil
+	}
+	if err != nil {
+		s.errorLogger.Printf("s.pathService.BulkCreateFoundPaths. Plugin: %s; Error: %s\n", p.GetName(), err)
+		return err
+	}
+
+	err = s.pathService.RecordProgress(task.OriginTaskId, task.Depth)
+	if err != nil {
+		s.errorLogger.Printf("pathService.RecordProgress. Plugin: %s; Error: %s\n", p.GetName(), err)
+	}
+
+	if expansion.Found {
+		fmt.Println("Success found path:", task.Id)
+		err = s.taskService.DeleteAllTasksWithOrigin(task.OriginTaskId)
+		if err != nil {
+			s.errorLogger.Printf("taskService.DeleteAllTasksWithOrigin. Plugin: %s; Error: %s\n", p.GetName(), err)
+		}
+
+		err = s.pathService.UpdatePathStatusByTaskId(task.OriginTaskId, services.PathStatusFound)
+		if err != nil {
+			if errors.Is(err, services.ErrIllegalTransition) {
+				return nil
 			}
-		}(plugin, consumeTaskCh)
+			s.errorLogger.Printf("pathService.UpdatePathStatusByTaskId. Plugin: %s; Error: %s\n", p.GetName(), err)
+			return err
+		}
+
+		// The trace is also built on demand when the path is requested, so
+		// failures here don't fail the task.
+		path, err := s.pathService.GetPathByTaskId(task.OriginTaskId)
+		if err != nil {
+			s.errorLogger.Printf("pathService.GetPathByTaskId. Plugin: %s; Error: %s\n", p.GetName(), err)
+			return nil
+		}
+
+		_, err = s.pathService.BuildFullTraceAndUpdate(path)
+		if err != nil {
+			s.errorLogger.Printf("pathService.BuildFullTraceAndUpdate. Plugin: %s; Error: %s\n", p.GetName(), err)
+		}
+		return nil
 	}
+
+	var createErr error
+	for _, newTask := range expansion.Tasks {
+		_, err := s.taskService.CreateNewTask(newTask)
+		if err != nil {
+			s.errorLogger.Printf("s.taskService.CreateNewTask. Plugin: %s; Error: %s\n", p.GetName(), err)
+			createErr = err
+		}
+	}
+
+	return createErr
 }
 
-func createHTTPServer(handlers *ahandlers.Handlers) *http.Server {
+// finishTask marks the path of the task origin as not found once its frontier
+// is exhausted. Tasks stay in the tasks queue until processed, so an empty
+// queue means no instance has anything left to expand.
+func (s *Seeker) finishTask(p aplugin.Plugin, task *services.Task) {
+	count, err := s.taskService.CountTasksWithOrigin(task.OriginTaskId)
+	if err != nil {
+		s.errorLogger.Printf("taskService.CountTasksWithOrigin. Plugin: %s; Error: %s\n", p.GetName(), err)
+		return
+	}
+
+	if count > 0 {
+		return
+	}
+
+	err = s.pathService.UpdatePathStatusByTaskId(task.OriginTaskId, services.PathStatusNotFound)
+	if err != nil && err != pgx.ErrNoRows && !errors.Is(err, services.ErrIllegalTransition) {
+		s.errorLogger.Printf("pathService.UpdatePathStatusByTaskId. Plugin: %s; Error: %s\n", p.GetName(), err)
+	}
+}
+
+// createHTTPServer builds the API server. Requests are cancelled once ctx is
+// done, so long-polls and event streams don't hold up the shutdown. There is no
+// write timeout because of them, ?wait= is bounded by the handlers instead.
+func createHTTPServer(ctx context.Context, handlers *ahandlers.Handlers) *http.Server {
 	apiRouter := mux.NewRouter().StrictSlash(false).PathPrefix("/api/v1").Subrouter()
 
 	apiRouter.HandleFunc("/task", (*handlers).CreateTask).Methods(http.MethodPost)
@@ -212,19 +672,62 @@ func createHTTPServer(handlers *ahandlers.Handlers) *http.Server {
 
 	taskSubrouter.HandleFunc("", (*handlers).GetPath).Methods(http.MethodGet)
 	taskSubrouter.HandleFunc("", (*handlers).DeleteTask).Methods(http.MethodDelete)
+	taskSubrouter.HandleFunc("/events", (*handlers).GetPathEvents).Methods(http.MethodGet)
+
+	apiRouter.HandleFunc("/plugins", (*handlers).GetPlugins).Methods(http.MethodGet)
+
+	adminSubrouter := apiRouter.PathPrefix("/admin").Subrouter()
+
+	adminSubrouter.HandleFunc("/dead-letters", (*handlers).GetDeadLetters).Methods(http.MethodGet)
+	adminSubrouter.HandleFunc("/dead-letters/{deadLetterId}/requeue", (*handlers).RequeueDeadLetter).Methods(http.MethodPost)
 
 	return &http.Server{
-		Handler:      apiRouter,
-		Addr:         ":8080",
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+		Handler:     apiRouter,
+		Addr:        ":8080",
+		ReadTimeout: 15 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
 	}
 }
 
+// Run serves the HTTP API and processes tasks until the shutdown context
+// passed to New is done, then shuts everything down gracefully.
 func (s *Seeker) Run() error {
-	s.startQueues()
+	producersCtx, stopProducers := context.WithCancel(context.Background())
+	defer stopProducers()
+
+	s.startQueues(producersCtx)
+
+	server := createHTTPServer(s.shutdownCtx, s.handlers)
+
+	serverErrCh := make(chan error, 1)
+	go func() {
+		serverErrCh <- server.ListenAndServe()
+	}()
+
+	var serverErr error
+	select {
+	case <-s.shutdownCtx.Done():
+	case serverErr = <-serverErrCh:
+	}
 
-	server := createHTTPServer(s.handlers)
+	log.Println("Shutting down seeker...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		s.errorLogger.Printf("server.Shutdown: %s\n", err)
+	}
+
+	stopProducers()
+	s.stopQueues(ctx)
+	s.closePlugins()
+
+	if serverErr == http.ErrServerClosed {
+		return nil
+	}
 
-	return server.ListenAndServe()
+	return serverErr
 }
@@ -0,0 +1,459 @@
+package seeker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/malcolmmadsheep/handshakes-seeker/internal/dbhandlers"
+	"github.com/malcolmmadsheep/handshakes-seeker/internal/memservices"
+	aplugin "github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+	aqueue "github.com/malcolmmadsheep/handshakes-seeker/pkg/queue"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
+)
+
+const searchTimeout = 10 * time.Second
+
+// graphPlugin searches a graph given by adjacency lists.
+type graphPlugin struct {
+	name  string
+	links map[string][]string
+
+	mu sync.Mutex
+	// failures is the number of requests of a node that fail before it's
+	// listed.
+	failures map[string]int
+	// retryAfter asks the seeker to back off for that long on failures.
+	retryAfter time.Duration
+}
+
+func newGraphPlugin(name string, links map[string][]string) *graphPlugin {
+	return &graphPlugin{
+		name:     name,
+		links:    links,
+		failures: make(map[string]int),
+	}
+}
+
+func (p *graphPlugin) GetName() string {
+	return p.name
+}
+
+func (p *graphPlugin) GetQueueConfig() aqueue.Config {
+	return aqueue.Config{
+		QueueSize: 10,
+		Workers:   2,
+	}
+}
+
+func (p *graphPlugin) DoRequest(req aplugin.Request) (*aplugin.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failures[req.SourceUrl] > 0 {
+		p.failures[req.SourceUrl]--
+		if p.retryAfter > 0 {
+			return nil, aplugin.RetryAfter(errors.New("too many requests"), p.retryAfter)
+		}
+		return nil, errors.New("service unavailable")
+	}
+
+	response := &aplugin.Response{}
+	for _, node := range p.links[req.SourceUrl] {
+		response.Connections = append(response.Connections, aplugin.Connection{
+			SourceUrl: node,
+			DestUrl:   req.DestUrl,
+		})
+	}
+
+	return response, nil
+}
+
+type testSeeker struct {
+	*Seeker
+	handlers    *dbhandlers.Handlers
+	tasks       *memservices.TaskService
+	paths       *memservices.PathService
+	deadLetters *memservices.DeadLetterService
+}
+
+// startTestSeeker runs queues of a seeker keeping everything in memory. The
+// HTTP API isn't served, requests are passed to the handlers directly.
+func startTestSeeker(t *testing.T, plugins ...aplugin.Plugin) *testSeeker {
+	t.Helper()
+
+	tasks := memservices.NewTaskService()
+	paths := memservices.NewPathService()
+	deadLetters := memservices.NewDeadLetterService()
+	handlers := dbhandlers.New(nil, tasks, paths, deadLetters, plugins)
+
+	cfg := Config{
+		InstanceId:   t.Name(),
+		PollInterval: 10 * time.Millisecond,
+		Retry: RetryPolicy{
+			MaxAttempts: 3,
+			BaseDelay:   10 * time.Millisecond,
+			MaxDelay:    50 * time.Millisecond,
+		},
+	}
+
+	s, err := New(context.Background(), cfg, handlers, tasks, paths, deadLetters, plugins)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+
+	producersCtx, stopProducers := context.WithCancel(context.Background())
+	s.startQueues(producersCtx)
+
+	t.Cleanup(func() {
+		stopProducers()
+
+		ctx, cancel := context.WithTimeout(context.Background(), searchTimeout)
+		defer cancel()
+		s.stopQueues(ctx)
+	})
+
+	return &testSeeker{
+		Seeker:      s,
+		handlers:    handlers,
+		tasks:       tasks,
+		paths:       paths,
+		deadLetters: deadLetters,
+	}
+}
+
+// startSearch creates a search the way POST /api/v1/task does and returns its
+// task id.
+func (s *testSeeker) startSearch(t *testing.T, req dbhandlers.CreateTaskReq) string {
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.handlers.CreateTask(w, httptest.NewRequest(http.MethodPost, "/api/v1/task", strings.NewReader(string(body))))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("CreateTask: %d %s", w.Code, w.Body)
+	}
+
+	var resp struct {
+		TaskId string `json:"taskId"`
+	}
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatalf("CreateTask: %s", err)
+	}
+
+	return resp.TaskId
+}
+
+// waitForPath waits for the search of taskId to finish and returns its path
+// with the trace built.
+func (s *testSeeker) waitForPath(t *testing.T, taskId string) *services.Path {
+	t.Helper()
+
+	deadline := time.Now().Add(searchTimeout)
+	for {
+		path, err := s.paths.GetPathByTaskId(taskId)
+		if err != nil {
+			t.Fatalf("GetPathByTaskId: %s", err)
+		}
+
+		if path.Status != services.PathStatusInProgress.String() {
+			if path.Status == services.PathStatusFound.String() && path.Trace == "" {
+				path, err = s.paths.BuildFullTraceAndUpdate(path)
+				if err != nil {
+					t.Fatalf("BuildFullTraceAndUpdate: %s", err)
+				}
+			}
+
+			return path
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("search %s is still in progress after %s", taskId, searchTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSeekerFindsPath(t *testing.T) {
+	p := newGraphPlugin("graph", map[string][]string{
+		"a": {"x", "b"},
+		"b": {"y", "c"},
+		"c": {"a", "d"},
+		"x": {"y"},
+	})
+	s := startTestSeeker(t, p)
+
+	taskId := s.startSearch(t, dbhandlers.CreateTaskReq{SourceUrl: "a", DestUrl: "d"})
+	path := s.waitForPath(t, taskId)
+
+	if path.Status != services.PathStatusFound.String() {
+		t.Fatalf("status = %s, want %s", path.Status, services.PathStatusFound)
+	}
+	if path.Trace != "a,b,c,d" {
+		t.Errorf("trace = %q, want %q", path.Trace, "a,b,c,d")
+	}
+
+	count, _ := s.tasks.CountTasksWithOrigin(taskId)
+	if count != 0 {
+		t.Errorf("%d tasks are left after the path is found", count)
+	}
+}
+
+func TestSeekerNotFound(t *testing.T) {
+	p := newGraphPlugin("graph", map[string][]string{
+		"a": {"b", "c"},
+		"b": {"c"},
+		"d": {"a"},
+	})
+	s := startTestSeeker(t, p)
+
+	taskId := s.startSearch(t, dbhandlers.CreateTaskReq{SourceUrl: "a", DestUrl: "d"})
+	path := s.waitForPath(t, taskId)
+
+	if path.Status != services.PathStatusNotFound.String() {
+		t.Fatalf("status = %s, want %s", path.Status, services.PathStatusNotFound)
+	}
+}
+
+func TestSeekerRetriesFailedRequests(t *testing.T) {
+	p := newGraphPlugin("graph", map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+	})
+	p.failures["b"] = 2
+	s := startTestSeeker(t, p)
+
+	taskId := s.startSearch(t, dbhandlers.CreateTaskReq{SourceUrl: "a", DestUrl: "c"})
+	path := s.waitForPath(t, taskId)
+
+	if path.Status != services.PathStatusFound.String() || path.Trace != "a,b,c" {
+		t.Fatalf("path = %s %q, want found a,b,c", path.Status, path.Trace)
+	}
+}
+
+func TestSeekerDeadLettersExhaustedTasks(t *testing.T) {
+	p := newGraphPlugin("graph", map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+	})
+	p.failures["b"] = 3
+	s := startTestSeeker(t, p)
+
+	taskId := s.startSearch(t, dbhandlers.CreateTaskReq{SourceUrl: "a", DestUrl: "c"})
+	path := s.waitForPath(t, taskId)
+
+	if path.Status != services.PathStatusNotFound.String() {
+		t.Fatalf("status = %s, want %s", path.Status, services.PathStatusNotFound)
+	}
+
+	deadLetters, err := s.deadLetters.GetDeadLetters(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].Task.SourceUrl != "b" || deadLetters[0].Task.Attempts != 3 {
+		t.Fatalf("dead letters = %+v, want the task of b after 3 attempts", deadLetters)
+	}
+}
+
+func TestSeekerRunsSeveralPlugins(t *testing.T) {
+	wiki := newGraphPlugin("wiki", map[string][]string{"a": {"b"}, "b": {"c"}})
+	wiki.failures["b"] = 1
+	wiki.retryAfter = 20 * time.Millisecond
+	org := newGraphPlugin("org", map[string][]string{"x": {"y"}, "y": {"z"}})
+	org.failures["y"] = 1
+	org.retryAfter = 20 * time.Millisecond
+	s := startTestSeeker(t, wiki, org)
+
+	searches := map[string]dbhandlers.CreateTaskReq{
+		"a,b,c": {SourceUrl: "a", DestUrl: "c", DataSource: "wiki"},
+		"x,y,z": {SourceUrl: "x", DestUrl: "z", DataSource: "org"},
+	}
+	taskIds := make(map[string]string, len(searches))
+	for trace, req := range searches {
+		taskIds[trace] = s.startSearch(t, req)
+	}
+
+	for trace, taskId := range taskIds {
+		path := s.waitForPath(t, taskId)
+		if path.Status != services.PathStatusFound.String() || path.Trace != trace {
+			t.Errorf("path = %s %q, want found %s", path.Status, path.Trace, trace)
+		}
+	}
+}
+
+// staleTaskService reports every search as cancelled, as an instance holding
+// a requests count cached before the search was resubmitted does.
+type staleTaskService struct {
+	*memservices.TaskService
+}
+
+func (ts staleTaskService) ShouldSkipTask(*services.Task) bool {
+	return true
+}
+
+func TestSeekerPostponesTasksOfStaleCancelledSearches(t *testing.T) {
+	p := newGraphPlugin("graph", map[string][]string{"a": {"b"}})
+	tasks := memservices.NewTaskService()
+	paths := memservices.NewPathService()
+	deadLetters := memservices.NewDeadLetterService()
+	handlers := dbhandlers.New(nil, tasks, paths, deadLetters, []aplugin.Plugin{p})
+
+	s, err := New(context.Background(), Config{}, handlers, staleTaskService{tasks}, paths, deadLetters, []aplugin.Plugin{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := tasks.CreateNewTask(&services.Task{
+		Id:            "root",
+		OriginTaskId:  "root",
+		DataSource:    p.GetName(),
+		SourceUrl:     "a",
+		DestUrl:       "b",
+		RequestsCount: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = paths.CreateNewPath(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := s.GetTasks(p.GetName(), 1)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("GetTasks = %v, %v", claimed, err)
+	}
+
+	acked := false
+	delivery := aqueue.NewDelivery(nil, func() error { acked = true; return nil }, func() error { return nil })
+
+	err = s.processTask(p, s.strategies[p.GetName()], claimed[0])
+	if !errors.Is(err, errTaskPostponed) {
+		t.Fatalf("processTask = %v, want %v", err, errTaskPostponed)
+	}
+	s.completeTask(p, claimed[0], delivery, err)
+
+	if !acked {
+		t.Error("delivery of the postponed task isn't acked")
+	}
+	if _, err := tasks.GetTaskById("root"); err != nil {
+		t.Errorf("postponed task is deleted: %s", err)
+	}
+	if path, _ := paths.GetPathByTaskId("root"); path.Status != services.PathStatusInProgress.String() {
+		t.Errorf("status = %s, want %s", path.Status, services.PathStatusInProgress)
+	}
+	if claimed, _ := s.GetTasks(p.GetName(), 1); len(claimed) != 0 {
+		t.Errorf("postponed task is claimed again right away")
+	}
+
+	err = paths.UpdatePathStatusByTaskId("root", services.PathStatusCancelled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	skip, err := s.skipTask(task)
+	if !skip || err != nil {
+		t.Errorf("skipTask of a cancelled search = %t, %v, want true, nil", skip, err)
+	}
+}
+
+// gatedPlugin holds requests of a node until the test releases them. gates
+// maps nodes to the number of the request of the node to hold, counting
+// from 1.
+type gatedPlugin struct {
+	*graphPlugin
+
+	gates    map[string]int
+	requests map[string]int
+	// held receives the release channel of every held request.
+	held chan chan struct{}
+}
+
+func (p *gatedPlugin) DoRequest(req aplugin.Request) (*aplugin.Response, error) {
+	p.mu.Lock()
+	p.requests[req.SourceUrl]++
+	hold := p.requests[req.SourceUrl] == p.gates[req.SourceUrl]
+	p.mu.Unlock()
+
+	if hold {
+		release := make(chan struct{})
+		p.held <- release
+		<-release
+	}
+
+	return p.graphPlugin.DoRequest(req)
+}
+
+func waitForHeld(t *testing.T, p *gatedPlugin) chan struct{} {
+	t.Helper()
+
+	select {
+	case release := <-p.held:
+		return release
+	case <-time.After(searchTimeout):
+		t.Fatal("no request is held")
+		return nil
+	}
+}
+
+func TestSeekerDropsExpansionsOfRestartedSearches(t *testing.T) {
+	p := &gatedPlugin{
+		graphPlugin: newGraphPlugin("graph", map[string][]string{
+			"a": {"b"},
+			"b": {"c"},
+			"c": {"d"},
+		}),
+		// The first run is held expanding c, the second one expanding a.
+		gates:    map[string]int{"c": 1, "a": 2},
+		requests: make(map[string]int),
+		held:     make(chan chan struct{}, 2),
+	}
+	s := startTestSeeker(t, p)
+
+	req := dbhandlers.CreateTaskReq{SourceUrl: "a", DestUrl: "d"}
+	taskId := s.startSearch(t, req)
+	releaseStale := waitForHeld(t, p)
+
+	w := httptest.NewRecorder()
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/api/v1/task/"+taskId, nil), map[string]string{"taskId": taskId})
+	s.handlers.DeleteTask(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("DeleteTask: %d %s", w.Code, w.Body)
+	}
+
+	if restartedId := s.startSearch(t, req); restartedId != taskId {
+		t.Fatalf("restarted search %s, want %s", restartedId, taskId)
+	}
+	releaseRestarted := waitForHeld(t, p)
+
+	// The first run finds d while the edges it found before are gone.
+	close(releaseStale)
+	time.Sleep(100 * time.Millisecond)
+
+	path, err := s.paths.GetPathByTaskId(taskId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Status != services.PathStatusInProgress.String() {
+		t.Fatalf("status = %s after the first run found d, want %s", path.Status, services.PathStatusInProgress)
+	}
+
+	close(releaseRestarted)
+	path = s.waitForPath(t, taskId)
+
+	if path.Status != services.PathStatusFound.String() || path.Trace != "a,b,c,d" {
+		t.Fatalf("path = %s %q, want found a,b,c,d", path.Status, path.Trace)
+	}
+}
@@ -0,0 +1,321 @@
+package seeker
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	aplugin "github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
+)
+
+const (
+	StrategyBFS           = "bfs"
+	StrategyBidirectional = "bidirectional"
+)
+
+// Expansion is the outcome of processing a single task.
+type Expansion struct {
+	// Tasks are new tasks to be queued for the same origin.
+	Tasks []*services.Task
+	// Edges are newly discovered nodes of the search. Each edge points to the
+	// edge of the node it was discovered from, so the full trace can be
+	// assembled by walking parents.
+	Edges []services.PathShapeForBulk
+	// Found reports that the search of the task origin is complete.
+	Found bool
+}
+
+// SearchStrategy decides how a search expands from a processed task and when
+// it is complete.
+type SearchStrategy interface {
+	GetName() string
+	Expand(p aplugin.Plugin, task *services.Task) (*Expansion, error)
+	// ExpandResponse is Expand with the request of the task already made,
+	// e.g. as a part of a batch.
+	ExpandResponse(p aplugin.Plugin, task *services.Task, response *aplugin.Response) (*Expansion, error)
+}
+
+// newStrategy picks the best strategy the capabilities of a plugin allow.
+// Searches run from both ends if the plugin lists backlinks. Weights only
+// order connections of a response, the search still claims tasks in the
+// order they were created.
+func newStrategy(p aplugin.Plugin, taskService services.TaskService, pathService services.PathService) SearchStrategy {
+	capabilities := aplugin.GetCapabilities(p)
+
+	return &bfsStrategy{
+		bidirectional: capabilities.Backlinks,
+		weighted:      capabilities.Weights,
+		taskService:   taskService,
+		pathService:   pathService,
+	}
+}
+
+type bfsStrategy struct {
+	bidirectional bool
+	// weighted checks lighter connections of a response first and creates
+	// their tasks first. Tasks of other responses aren't reordered.
+	weighted    bool
+	taskService services.TaskService
+	pathService services.PathService
+}
+
+// NewBFSStrategy returns a strategy expanding forward only, visiting every
+// node at most once per search.
+func NewBFSStrategy(taskService services.TaskService, pathService services.PathService) SearchStrategy {
+	return &bfsStrategy{
+		taskService: taskService,
+		pathService: pathService,
+	}
+}
+
+// NewBidirectionalStrategy returns a strategy expanding forward from the
+// source and backward from the destination until the two frontiers meet.
+// Backward expansion requires a plugin advertising backlinks, otherwise the
+// strategy behaves like NewBFSStrategy.
+func NewBidirectionalStrategy(taskService services.TaskService, pathService services.PathService) SearchStrategy {
+	return &bfsStrategy{
+		bidirectional: true,
+		taskService:   taskService,
+		pathService:   pathService,
+	}
+}
+
+func (s *bfsStrategy) GetName() string {
+	if s.bidirectional {
+		return StrategyBidirectional
+	}
+
+	return StrategyBFS
+}
+
+// nodeId identifies a node visited in the given direction within a single
+// run of the search of task. It is used both as the id of the task expanding
+// the node and as the hash of the edge the node was discovered through. Runs
+// after a restart get their own ids, so leftovers of earlier runs never
+// collide with them.
+func (s *bfsStrategy) nodeId(task *services.Task, direction services.TaskDirection, node, cursor string) string {
+	key := node
+	if direction == services.TaskDirectionBackward {
+		key = "<" + key
+	}
+	if cursor != "" {
+		key += "#" + cursor
+	}
+	if task.Generation > 0 {
+		key = strconv.Itoa(task.Generation) + ":" + key
+	}
+
+	return s.taskService.GenerateId(task.OriginTaskId, key)
+}
+
+func (s *bfsStrategy) newTask(parent *services.Task, direction services.TaskDirection, node, target, cursor string, depth int) *services.Task {
+	parentTaskId := s.nodeId(parent, parent.Direction, parent.SourceUrl, "")
+	if direction != parent.Direction {
+		parentTaskId = ""
+	} else if node == parent.SourceUrl {
+		parentTaskId = parent.ParentTaskId
+	}
+
+	return &services.Task{
+		Id:            s.nodeId(parent, direction, node, cursor),
+		OriginTaskId:  parent.OriginTaskId,
+		ParentTaskId:  parentTaskId,
+		DataSource:    parent.DataSource,
+		SourceUrl:     node,
+		DestUrl:       target,
+		Cursor:        cursor,
+		RequestsCount: parent.RequestsCount,
+		Direction:     direction,
+		Depth:         depth,
+		MaxDepth:      parent.MaxDepth,
+		Filter:        parent.Filter,
+		Generation:    parent.Generation,
+	}
+}
+
+// newEdge records the discovery of node from parentNode. Edges keep the
+// direction of the underlying link, so backward edges point from node to
+// parentNode. Roots of the search have no parent.
+func (s *bfsStrategy) newEdge(task *services.Task, direction services.TaskDirection, parentNode, node string, depth int) services.PathShapeForBulk {
+	edge := services.PathShapeForBulk{
+		DataSource:   task.DataSource,
+		TaskId:       s.nodeId(task, direction, node, ""),
+		OriginTaskId: task.OriginTaskId,
+		Direction:    direction,
+		Depth:        depth,
+		SourceUrl:    node,
+		DestUrl:      node,
+		Generation:   task.Generation,
+	}
+
+	if parentNode != "" {
+		edge.ParentTaskId = s.nodeId(task, direction, parentNode, "")
+		if direction == services.TaskDirectionBackward {
+			edge.DestUrl = parentNode
+		} else {
+			edge.SourceUrl = parentNode
+		}
+	}
+
+	edge.Trace = strings.Join([]string{edge.SourceUrl, edge.DestUrl}, ",")
+
+	return edge
+}
+
+// depthLimit returns the maximum depth of tasks going in the given direction.
+// Bidirectional searches split the hops budget between both directions.
+func depthLimit(task *services.Task, direction services.TaskDirection, bidirectional bool) int {
+	if task.MaxDepth <= 0 || !bidirectional {
+		return task.MaxDepth
+	}
+
+	if direction == services.TaskDirectionBackward {
+		return task.MaxDepth / 2
+	}
+
+	return (task.MaxDepth + 1) / 2
+}
+
+func withinMaxDepth(task *services.Task, hops int) bool {
+	return task.MaxDepth <= 0 || hops <= task.MaxDepth
+}
+
+// taskRequest builds the plugin request expanding the task.
+func taskRequest(task *services.Task) aplugin.Request {
+	return aplugin.Request{
+		SourceUrl: task.SourceUrl,
+		DestUrl:   task.DestUrl,
+		Cursor:    task.Cursor,
+		Filter: aplugin.LinkFilter{
+			Namespaces:         task.Filter.Namespaces,
+			KeepRedirects:      task.Filter.KeepRedirects,
+			SkipDisambiguation: task.Filter.SkipDisambiguation,
+		},
+	}
+}
+
+func (s *bfsStrategy) Expand(p aplugin.Plugin, task *services.Task) (*Expansion, error) {
+	request := taskRequest(task)
+
+	var (
+		response *aplugin.Response
+		err      error
+	)
+	if task.Direction == services.TaskDirectionBackward {
+		backlinksPlugin, canGoBackward := aplugin.AsBacklinksPlugin(p)
+		if !canGoBackward {
+			return &Expansion{}, nil
+		}
+		response, err = backlinksPlugin.DoBacklinksRequest(request)
+	} else {
+		response, err = p.DoRequest(request)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ExpandResponse(p, task, response)
+}
+
+func (s *bfsStrategy) ExpandResponse(p aplugin.Plugin, task *services.Task, response *aplugin.Response) (*Expansion, error) {
+	_, canGoBackward := aplugin.AsBacklinksPlugin(p)
+	bidirectional := s.bidirectional && canGoBackward
+
+	if task.Direction == services.TaskDirectionBackward && !canGoBackward {
+		return &Expansion{}, nil
+	}
+
+	connections := response.Connections
+	if s.weighted {
+		connections = make([]aplugin.Connection, len(response.Connections))
+		copy(connections, response.Connections)
+		sort.SliceStable(connections, func(i, j int) bool { return connections[i].Weight < connections[j].Weight })
+	}
+
+	opposite := services.TaskDirectionBackward
+	if task.Direction == services.TaskDirectionBackward {
+		opposite = services.TaskDirectionForward
+	}
+
+	visited, err := s.visitedEdges(task, opposite, connections)
+	if err != nil {
+		return nil, err
+	}
+
+	expansion := &Expansion{}
+
+	if task.Id == task.OriginTaskId && task.Cursor == "" {
+		root := s.newEdge(task, services.TaskDirectionForward, "", task.SourceUrl, 0)
+		expansion.Edges = append(expansion.Edges, root)
+		visited[root.TaskId] = &services.Path{}
+
+		backwardAllowed := task.MaxDepth <= 0 || depthLimit(task, services.TaskDirectionBackward, true) > 0
+		if bidirectional && backwardAllowed {
+			root := s.newEdge(task, services.TaskDirectionBackward, "", task.DestUrl, 0)
+			expansion.Edges = append(expansion.Edges, root)
+			visited[root.TaskId] = &services.Path{}
+			expansion.Tasks = append(expansion.Tasks, s.newTask(task, services.TaskDirectionBackward, task.DestUrl, task.SourceUrl, "", 0))
+		}
+	}
+
+	depth := task.Depth + 1
+	limit := depthLimit(task, task.Direction, bidirectional)
+
+	for _, connection := range connections {
+		if connection.SourceUrl == task.SourceUrl && connection.Cursor != "" {
+			expansion.Tasks = append(expansion.Tasks, s.newTask(task, task.Direction, task.SourceUrl, task.DestUrl, connection.Cursor, task.Depth))
+			continue
+		}
+
+		node := connection.SourceUrl
+		edge := s.newEdge(task, task.Direction, task.SourceUrl, node, depth)
+		if _, contains := visited[edge.TaskId]; contains {
+			continue
+		}
+
+		expansion.Edges = append(expansion.Edges, edge)
+		visited[edge.TaskId] = &services.Path{Depth: depth}
+
+		met, contains := visited[s.nodeId(task, opposite, node, "")]
+		if !contains && task.Direction == services.TaskDirectionForward && node == task.DestUrl {
+			met, contains = &services.Path{}, true
+		}
+		if contains && withinMaxDepth(task, depth+met.Depth) {
+			expansion.Found = true
+			return expansion, nil
+		}
+
+		if limit > 0 && depth >= limit {
+			continue
+		}
+
+		expansion.Tasks = append(expansion.Tasks, s.newTask(task, task.Direction, node, task.DestUrl, "", depth))
+	}
+
+	return expansion, nil
+}
+
+// visitedEdges loads the stored edges of the connected nodes, both in the task
+// direction and in the opposite one, keyed by edge hash.
+func (s *bfsStrategy) visitedEdges(task *services.Task, opposite services.TaskDirection, connections []aplugin.Connection) (map[string]*services.Path, error) {
+	ids := make([]string, 0, 2*len(connections))
+	for _, connection := range connections {
+		ids = append(ids,
+			s.nodeId(task, task.Direction, connection.SourceUrl, ""),
+			s.nodeId(task, opposite, connection.SourceUrl, ""),
+		)
+	}
+
+	paths, err := s.pathService.GetPathsByTaskIds(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	visited := make(map[string]*services.Path, len(paths))
+	for _, path := range paths {
+		visited[path.TaskHash] = path
+	}
+
+	return visited, nil
+}
@@ -2,46 +2,256 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/jackc/pgx/v4/pgxpool"
 	seeker "github.com/malcolmmadsheep/handshakes-seeker/cmd/seeker/app"
 	"github.com/malcolmmadsheep/handshakes-seeker/internal/dbhandlers"
+	"github.com/malcolmmadsheep/handshakes-seeker/internal/dbqueue"
 	"github.com/malcolmmadsheep/handshakes-seeker/internal/dbservices"
+	"github.com/malcolmmadsheep/handshakes-seeker/internal/memservices"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/aconfig"
 	"github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/queue"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
 	"github.com/malcolmmadsheep/handshakes-seeker/plugins"
 )
 
+const (
+	storagePostgres = "postgres"
+	storageMemory   = "memory"
+)
+
+const (
+	queueBackendChannel  = "channel"
+	queueBackendPostgres = "postgres"
+)
+
 func main() {
-	cfg := seeker.Config{}
+	storage := flag.String("storage", storagePostgres, "storage backend: postgres or memory")
+	flag.Parse()
 
-	log.Println("Connecting to database...")
-	conn, err := pgxpool.Connect(context.Background(), os.Getenv("DATABASE_URL"))
-	if err != nil {
-		log.Fatalf("Couldn't set up connection with database %s", err)
+	cfg := seeker.Config{
+		InstanceId:    os.Getenv("HANDSHAKES_INSTANCE_ID"),
+		LeaseDuration: time.Duration(aconfig.GetEnvOrInt("HANDSHAKES_TASK_LEASE_SECONDS", 300)) * time.Second,
+		Retry: seeker.RetryPolicy{
+			MaxAttempts: aconfig.GetEnvOrInt("HANDSHAKES_TASK_MAX_ATTEMPTS", 5),
+			BaseDelay:   time.Duration(aconfig.GetEnvOrInt("HANDSHAKES_TASK_RETRY_DELAY", 1000)) * time.Millisecond,
+			MaxDelay:    time.Duration(aconfig.GetEnvOrInt("HANDSHAKES_TASK_RETRY_MAX_DELAY", 60000)) * time.Millisecond,
+		},
 	}
-	log.Println("Successfully connected to database...")
 
-	err = runDBMigration(conn)
-	if err != nil {
-		log.Fatalf("DB migration failed %s", err)
+	var (
+		conn        *pgxpool.Pool
+		taskService services.TaskService
+		pathService services.PathService
+		deadLetters services.DeadLetterService
+	)
+
+	switch *storage {
+	case storagePostgres:
+		conn = connectDB()
+		taskService = dbservices.NewTaskService(conn)
+		pathService = dbservices.NewPathService(conn)
+		deadLetters = dbservices.NewDeadLetterService(conn)
+	case storageMemory:
+		log.Println("Using in-memory storage, data will be lost on shutdown...")
+		taskService = memservices.NewTaskService()
+		pathService = memservices.NewPathService()
+		deadLetters = memservices.NewDeadLetterService()
+	default:
+		log.Fatalf("Unknown storage %q, expected %q or %q", *storage, storagePostgres, storageMemory)
 	}
 
-	taskService := dbservices.NewTaskService(conn)
-	pathService := dbservices.NewPathService(conn)
+	switch queueBackend := os.Getenv("HANDSHAKES_QUEUE_BACKEND"); queueBackend {
+	case "", queueBackendChannel:
+	case queueBackendPostgres:
+		if conn == nil {
+			log.Fatalf("Queue backend %q requires %q storage", queueBackendPostgres, storagePostgres)
+		}
+		visibilityTimeout := time.Duration(aconfig.GetEnvOrInt("HANDSHAKES_QUEUE_VISIBILITY_SECONDS", 60)) * time.Second
+		cfg.NewQueue = func(name string, config queue.Config) queue.Queue {
+			return dbqueue.New(conn, name, config, visibilityTimeout)
+		}
+	default:
+		log.Fatalf("Unknown queue backend %q, expected %q or %q", queueBackend, queueBackendChannel, queueBackendPostgres)
+	}
 
-	handlers := dbhandlers.New(conn, taskService, pathService)
-	wikipediaPlugin := &plugins.WikipediaPlugin{}
+	plugins := loadPlugins()
 
-	plugins := []plugin.Plugin{wikipediaPlugin}
+	handlers := dbhandlers.New(conn, taskService, pathService, deadLetters, plugins)
 
-	skr, err := seeker.New(context.Background(), cfg, handlers, taskService, pathService, plugins)
+	shutdownCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	skr, err := seeker.New(shutdownCtx, cfg, handlers, taskService, pathService, deadLetters, plugins)
 	if err != nil {
 		log.Fatalf("Failed to run seeker: %s", err)
 	}
 
 	if err := skr.Run(); err != nil {
-		log.Fatalf("Seeker is shutdown")
+		log.Fatalf("Seeker is shutdown: %s", err)
+	}
+
+	if conn != nil {
+		conn.Close()
+	}
+	log.Println("Seeker is stopped")
+}
+
+// loadPlugins creates a plugin for every MediaWiki site listed in the file
+// from HANDSHAKES_WIKI_SITES, for every dump listed in the file from
+// HANDSHAKES_DUMPS, for every graph listed in the file from
+// HANDSHAKES_GRAPH_FILES and for every API listed in the file from
+// HANDSHAKES_HTTP_PLUGINS, and starts every plugin listed in the file from
+// HANDSHAKES_PROCESS_PLUGINS. The English Wikipedia is searched if none is
+// set.
+func loadPlugins() []plugin.Plugin {
+	sitesPath := os.Getenv("HANDSHAKES_WIKI_SITES")
+	dumpsPath := os.Getenv("HANDSHAKES_DUMPS")
+	graphFilesPath := os.Getenv("HANDSHAKES_GRAPH_FILES")
+	httpPluginsPath := os.Getenv("HANDSHAKES_HTTP_PLUGINS")
+	processPluginsPath := os.Getenv("HANDSHAKES_PROCESS_PLUGINS")
+
+	wikipediaConfigs := []plugins.WikipediaConfig{}
+	if sitesPath != "" {
+		configs, err := plugins.LoadWikipediaConfigs(sitesPath)
+		if err != nil {
+			log.Fatalf("Couldn't load MediaWiki sites: %s", err)
+		}
+		wikipediaConfigs = configs
+	} else if dumpsPath == "" && graphFilesPath == "" && httpPluginsPath == "" && processPluginsPath == "" {
+		wikipediaConfigs = append(wikipediaConfigs, plugins.DefaultWikipediaConfig())
+	}
+
+	dumpConfigs := []plugins.DumpConfig{}
+	if dumpsPath != "" {
+		configs, err := plugins.LoadDumpConfigs(dumpsPath)
+		if err != nil {
+			log.Fatalf("Couldn't load dumps: %s", err)
+		}
+		dumpConfigs = configs
+	}
+
+	graphFileConfigs := []plugins.GraphFileConfig{}
+	if graphFilesPath != "" {
+		configs, err := plugins.LoadGraphFileConfigs(graphFilesPath)
+		if err != nil {
+			log.Fatalf("Couldn't load graph files: %s", err)
+		}
+		graphFileConfigs = configs
+	}
+
+	httpPluginConfigs := []plugins.HTTPPluginConfig{}
+	if httpPluginsPath != "" {
+		configs, err := plugins.LoadHTTPPluginConfigs(httpPluginsPath)
+		if err != nil {
+			log.Fatalf("Couldn't load HTTP plugins: %s", err)
+		}
+		httpPluginConfigs = configs
+	}
+
+	processPluginConfigs := []plugins.ProcessPluginConfig{}
+	if processPluginsPath != "" {
+		configs, err := plugins.LoadProcessPluginConfigs(processPluginsPath)
+		if err != nil {
+			log.Fatalf("Couldn't load process plugins: %s", err)
+		}
+		processPluginConfigs = configs
+	}
+
+	pluginsCount := len(wikipediaConfigs) + len(dumpConfigs) + len(graphFileConfigs) + len(httpPluginConfigs) + len(processPluginConfigs)
+	loaded := make([]plugin.Plugin, 0, pluginsCount)
+	names := make(map[string]bool, pluginsCount)
+	checkName := func(name string) {
+		if names[name] {
+			log.Fatalf("Plugin %q is configured twice", name)
+		}
+		names[name] = true
+	}
+
+	for _, config := range wikipediaConfigs {
+		checkName(config.Name)
+
+		wikipediaPlugin, err := plugins.NewWikipediaPlugin(config)
+		if err != nil {
+			log.Fatalf("Couldn't set up MediaWiki site: %s", err)
+		}
+
+		loaded = append(loaded, wikipediaPlugin)
 	}
+
+	for _, config := range dumpConfigs {
+		checkName(config.Name)
+
+		dumpPlugin, err := plugins.NewDumpPlugin(config)
+		if err != nil {
+			log.Fatalf("Couldn't set up dump: %s", err)
+		}
+
+		loaded = append(loaded, dumpPlugin)
+	}
+
+	for _, config := range graphFileConfigs {
+		checkName(config.Name)
+
+		graphFilePlugin, err := plugins.NewGraphFilePlugin(config)
+		if err != nil {
+			log.Fatalf("Couldn't load graph file: %s", err)
+		}
+
+		loaded = append(loaded, graphFilePlugin)
+	}
+
+	for _, config := range httpPluginConfigs {
+		checkName(config.Name)
+
+		httpPlugin, err := plugins.NewHTTPPlugin(config)
+		if err != nil {
+			log.Fatalf("Couldn't set up HTTP plugin: %s", err)
+		}
+
+		loaded = append(loaded, httpPlugin)
+	}
+
+	// Process plugins report their names, so they are checked once started.
+	for _, config := range processPluginConfigs {
+		log.Printf("Starting plugin %s...\n", config)
+
+		processPlugin, err := plugins.NewProcessPlugin(config)
+		if err != nil {
+			log.Fatalf("Couldn't start process plugin: %s", err)
+		}
+
+		checkName(processPlugin.GetName())
+
+		loaded = append(loaded, processPlugin)
+	}
+
+	if len(loaded) == 0 {
+		log.Fatalf("No plugins are configured")
+	}
+
+	return loaded
+}
+
+func connectDB() *pgxpool.Pool {
+	log.Println("Connecting to database...")
+	conn, err := pgxpool.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatalf("Couldn't set up connection with database %s", err)
+	}
+	log.Println("Successfully connected to database...")
+
+	err = runDBMigration(conn)
+	if err != nil {
+		log.Fatalf("DB migration failed %s", err)
+	}
+
+	return conn
 }
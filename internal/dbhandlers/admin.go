@@ -0,0 +1,141 @@
+package dbhandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v4"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
+)
+
+const (
+	defaultDeadLettersLimit = 50
+	maxDeadLettersLimit     = 500
+)
+
+func parseUintParam(r *http.Request, name string, defaultValue uint) (uint, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", name, value)
+	}
+
+	return uint(n), nil
+}
+
+func (h *Handlers) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseUintParam(r, "limit", defaultDeadLettersLimit)
+	if err == nil && limit > maxDeadLettersLimit {
+		limit = maxDeadLettersLimit
+	}
+
+	var offset uint
+	if err == nil {
+		offset, err = parseUintParam(r, "offset", 0)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "%s"}`, err)
+		return
+	}
+
+	deadLetters, err := h.deadLetterService.GetDeadLetters(limit, offset)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "%s"}`, err)
+		return
+	}
+
+	deadLettersStr, err := json.Marshal(deadLetters)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "%s"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"dead_letters": %s}`, deadLettersStr)
+}
+
+// RequeueDeadLetter puts the task of a dead letter back to the queue with a
+// fresh set of attempts and resumes its search if it ran out of tasks. Tasks
+// of found and cancelled searches aren't requeued, so a search isn't
+// restarted behind the back of those who cancelled it.
+func (h *Handlers) RequeueDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["deadLetterId"], 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	deadLetter, err := h.deadLetterService.GetDeadLetterById(uint(id))
+	if err == pgx.ErrNoRows {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "%s"}`, err)
+		return
+	}
+
+	task := deadLetter.Task
+	task.Attempts = 0
+	task.RequestsCount = 0
+
+	path, err := h.pathService.GetPathByTaskId(task.OriginTaskId)
+	if err == pgx.ErrNoRows {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, `{"error": "search %s doesn't exist"}`, task.OriginTaskId)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "%s"}`, err)
+		return
+	}
+
+	if path.Status != services.PathStatusInProgress.String() && path.Status != services.PathStatusNotFound.String() {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, `{"error": "search %s is %s"}`, task.OriginTaskId, path.Status)
+		return
+	}
+
+	if path.Generation != task.Generation {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, `{"error": "search %s was restarted since the task failed"}`, task.OriginTaskId)
+		return
+	}
+
+	_, err = h.taskService.CreateNewTask(task)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "%s"}`, err)
+		return
+	}
+
+	if path.Status == services.PathStatusNotFound.String() {
+		err = h.pathService.UpdatePathStatusByTaskId(task.OriginTaskId, services.PathStatusInProgress)
+		if err != nil && !errors.Is(err, services.ErrIllegalTransition) {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "%s"}`, err)
+			return
+		}
+	}
+
+	err = h.deadLetterService.DeleteDeadLetterById(deadLetter.Id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "%s"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"taskId": "%s"}`, task.Id)
+}
@@ -0,0 +1,73 @@
+package dbhandlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/malcolmmadsheep/handshakes-seeker/internal/memservices"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
+)
+
+func TestRequeueDeadLetter(t *testing.T) {
+	tests := []struct {
+		status     services.PathStatus
+		wantCode   int
+		wantStatus services.PathStatus
+	}{
+		{services.PathStatusInProgress, http.StatusOK, services.PathStatusInProgress},
+		{services.PathStatusNotFound, http.StatusOK, services.PathStatusInProgress},
+		{services.PathStatusFound, http.StatusConflict, services.PathStatusFound},
+		{services.PathStatusCancelled, http.StatusConflict, services.PathStatusCancelled},
+	}
+
+	for _, test := range tests {
+		t.Run(test.status.String(), func(t *testing.T) {
+			tasks := memservices.NewTaskService()
+			paths := memservices.NewPathService()
+			deadLetters := memservices.NewDeadLetterService()
+			h := New(nil, tasks, paths, deadLetters, nil)
+
+			origin := &services.Task{Id: "origin", OriginTaskId: "origin", SourceUrl: "a", DestUrl: "c"}
+			_, err := paths.CreateNewPath(origin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.status != services.PathStatusInProgress {
+				err = paths.UpdatePathStatusByTaskId("origin", test.status)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			task := &services.Task{Id: "b", OriginTaskId: "origin", SourceUrl: "b", DestUrl: "c", Attempts: 5}
+			deadLetter, err := deadLetters.CreateDeadLetter(task, "service unavailable")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/admin/dead-letters/1/requeue", nil)
+			r = mux.SetURLVars(r, map[string]string{"deadLetterId": strconv.Itoa(int(deadLetter.Id))})
+			w := httptest.NewRecorder()
+			h.RequeueDeadLetter(w, r)
+
+			if w.Code != test.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, test.wantCode, w.Body)
+			}
+
+			path, _ := paths.GetPathByTaskId("origin")
+			if path.Status != test.wantStatus.String() {
+				t.Errorf("status = %s, want %s", path.Status, test.wantStatus)
+			}
+
+			_, taskErr := tasks.GetTaskById("b")
+			_, deadLetterErr := deadLetters.GetDeadLetterById(deadLetter.Id)
+			requeued := test.wantCode == http.StatusOK
+			if (taskErr == nil) != requeued || (deadLetterErr != nil) != requeued {
+				t.Errorf("task error = %v, dead letter error = %v, want requeued = %t", taskErr, deadLetterErr, requeued)
+			}
+		})
+	}
+}
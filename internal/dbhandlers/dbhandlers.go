@@ -2,12 +2,15 @@ package dbhandlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
 	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
 )
 
@@ -15,36 +18,210 @@ type Handlers struct {
 	conn        *pgxpool.Pool
 	taskService services.TaskService
 	pathService services.PathService
+
+	deadLetterService services.DeadLetterService
+
+	// plugins are the plugins tasks can be created for, the first one is used
+	// when a task doesn't name its data source.
+	plugins []plugin.Plugin
 }
 
 func New(
 	conn *pgxpool.Pool,
 	taskService services.TaskService,
 	pathService services.PathService,
+	deadLetterService services.DeadLetterService,
+	plugins []plugin.Plugin,
 ) *Handlers {
 	return &Handlers{
 		conn,
 		taskService,
 		pathService,
+		deadLetterService,
+		plugins,
 	}
 }
 
 type CreateTaskReq struct {
-	SourceUrl string `json:"source_url"`
-	DestUrl   string `json:"dest_url"`
+	SourceUrl  string `json:"source_url"`
+	DestUrl    string `json:"dest_url"`
+	MaxDepth   int    `json:"max_depth"`
+	DataSource string `json:"data_source"`
+	// Filter narrows the links followed by the search.
+	Filter services.LinkFilter `json:"filter"`
+}
+
+func (h *Handlers) defaultDataSource() string {
+	if len(h.plugins) == 0 {
+		return ""
+	}
+
+	return h.plugins[0].GetName()
+}
+
+func (h *Handlers) getPlugin(dataSource string) (plugin.Plugin, bool) {
+	for _, p := range h.plugins {
+		if p.GetName() == dataSource {
+			return p, true
+		}
+	}
+
+	return nil, false
+}
+
+// NotFoundNode is a search endpoint that doesn't exist in the data source.
+type NotFoundNode struct {
+	// Field is the request field naming the endpoint.
+	Field string `json:"field"`
+	Url   string `json:"url"`
+	// Node is the normalized node id of the endpoint.
+	Node string `json:"node"`
+}
+
+type NotFoundErrorResp struct {
+	Error    string         `json:"error"`
+	NotFound []NotFoundNode `json:"not_found"`
+}
+
+// writeNotFoundNodes responds with 422 listing the endpoints of createTaskReq
+// reported by notFoundErr.
+func writeNotFoundNodes(w http.ResponseWriter, createTaskReq *CreateTaskReq, sourceNode, destNode string, notFoundErr *plugin.NotFoundError) {
+	resp := NotFoundErrorResp{
+		Error:    "pages not found",
+		NotFound: make([]NotFoundNode, 0, 2),
+	}
+
+	notFound := make(map[string]bool, len(notFoundErr.Nodes))
+	for _, node := range notFoundErr.Nodes {
+		notFound[node] = true
+	}
+
+	if notFound[sourceNode] {
+		resp.NotFound = append(resp.NotFound, NotFoundNode{"source_url", createTaskReq.SourceUrl, sourceNode})
+	}
+	if notFound[destNode] {
+		resp.NotFound = append(resp.NotFound, NotFoundNode{"dest_url", createTaskReq.DestUrl, destNode})
+	}
+
+	respStr, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "%s"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	w.Write(respStr)
+}
+
+// normalizeErrorStatus tells urls the plugin rejects from failures of its
+// data source.
+func normalizeErrorStatus(err error) int {
+	if errors.Is(err, plugin.ErrPermanent) {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusBadGateway
+}
+
+// validateFilter checks filter and sorts its namespaces, so equal filters
+// produce equal task ids. An empty list of namespaces keeps the defaults.
+func validateFilter(filter *services.LinkFilter) error {
+	for _, namespace := range filter.Namespaces {
+		if namespace < 0 {
+			return fmt.Errorf("invalid filter namespace %d", namespace)
+		}
+	}
+
+	if len(filter.Namespaces) == 0 {
+		filter.Namespaces = nil
+		return nil
+	}
+
+	namespaces := make([]int, len(filter.Namespaces))
+	copy(namespaces, filter.Namespaces)
+	sort.Ints(namespaces)
+	filter.Namespaces = namespaces
+
+	return nil
+}
+
+// legacyDataSource is the data source of searches started before data
+// sources were introduced, when the English Wikipedia was the only one.
+const legacyDataSource = "wikipedia"
+
+// generateTaskId identifies the search of a pair of pages. Searches of
+// legacyDataSource without a filter keep ids they had before data sources and
+// filters were introduced, whatever the order of configured plugins.
+func (h *Handlers) generateTaskId(dataSource string, filter services.LinkFilter, sourceUrlTitle, destUrlTitle string) string {
+	if dataSource != legacyDataSource {
+		sourceUrlTitle = dataSource + ":" + sourceUrlTitle
+	}
+	if !filter.IsZero() {
+		// LinkFilter always marshals.
+		filterStr, _ := json.Marshal(filter)
+		destUrlTitle = destUrlTitle + "?" + string(filterStr)
+	}
+
+	return h.taskService.GenerateId(sourceUrlTitle, destUrlTitle)
 }
 
 func (h *Handlers) CreateTask(w http.ResponseWriter, r *http.Request) {
 	var createTaskReq CreateTaskReq
 	err := json.NewDecoder(r.Body).Decode(&createTaskReq)
-	if err != nil {
+	if err != nil || createTaskReq.MaxDepth < 0 {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	sourceUrlTitle := h.taskService.CutUrlTitle(createTaskReq.SourceUrl)
-	destUrlTitle := h.taskService.CutUrlTitle(createTaskReq.DestUrl)
-	taskId := h.taskService.GenerateId(sourceUrlTitle, destUrlTitle)
+	dataSource := createTaskReq.DataSource
+	if dataSource == "" {
+		dataSource = h.defaultDataSource()
+	}
+	p, contains := h.getPlugin(dataSource)
+	if !contains {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "unknown data_source %s"}`, dataSource)
+		return
+	}
+
+	// Task ids are computed from canonical node ids, so every way of naming
+	// the same pages leads to the same search.
+	sourceUrlTitle, err := plugin.Normalize(p, createTaskReq.SourceUrl)
+	if err != nil {
+		w.WriteHeader(normalizeErrorStatus(err))
+		fmt.Fprintf(w, `{"error": "source_url: %s"}`, err)
+		return
+	}
+	destUrlTitle, err := plugin.Normalize(p, createTaskReq.DestUrl)
+	if err != nil {
+		w.WriteHeader(normalizeErrorStatus(err))
+		fmt.Fprintf(w, `{"error": "dest_url: %s"}`, err)
+		return
+	}
+
+	// A search can't reach a page that doesn't exist, so it isn't started.
+	if resolver, canResolve := plugin.AsResolverPlugin(p); canResolve {
+		nodes, err := resolver.Resolve([]string{sourceUrlTitle, destUrlTitle})
+		var notFoundErr *plugin.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			writeNotFoundNodes(w, &createTaskReq, sourceUrlTitle, destUrlTitle, notFoundErr)
+			return
+		} else if err != nil {
+			w.WriteHeader(normalizeErrorStatus(err))
+			fmt.Fprintf(w, `{"error": "%s"}`, err)
+			return
+		}
+
+		sourceUrlTitle, destUrlTitle = nodes[0], nodes[1]
+	}
+	err = validateFilter(&createTaskReq.Filter)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "%s"}`, err)
+		return
+	}
+	taskId := h.generateTaskId(dataSource, createTaskReq.Filter, sourceUrlTitle, destUrlTitle)
 
 	if task, err := h.taskService.GetTaskById(taskId); err == nil {
 		_, err := h.taskService.UpdateTaskRequestsCount(task.OriginTaskId, 1)
@@ -62,21 +239,44 @@ func (h *Handlers) CreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	task, err := h.taskService.CreateNewTask(taskId, taskId, sourceUrlTitle, destUrlTitle, "", 1)
-
-	if err != nil {
+	// A restarted search is a new generation of it, its tasks are told apart
+	// from tasks of the earlier run still being processed.
+	generation := 0
+	path, err := h.pathService.GetPathByTaskId(taskId)
+	if err == nil && path.Status != services.PathStatusInProgress.String() {
+		err = h.pathService.ResetPathByTaskId(taskId)
+		if errors.Is(err, services.ErrIllegalTransition) {
+			err = nil
+		}
+		if err == nil {
+			path, err = h.pathService.GetPathByTaskId(taskId)
+		}
+	}
+	if err == nil {
+		generation = path.Generation
+	} else if err != pgx.ErrNoRows {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, `{"error": "%s"}`, err)
 		return
 	}
 
-	_, err = h.pathService.GetPathByTaskId(taskId)
+	task, err := h.taskService.CreateNewTask(&services.Task{
+		Id:            taskId,
+		OriginTaskId:  taskId,
+		DataSource:    dataSource,
+		SourceUrl:     sourceUrlTitle,
+		DestUrl:       destUrlTitle,
+		RequestsCount: 1,
+		Direction:     services.TaskDirectionForward,
+		MaxDepth:      createTaskReq.MaxDepth,
+		Filter:        createTaskReq.Filter,
+		Generation:    generation,
+	})
+
 	if err != nil {
-		if err != pgx.ErrNoRows {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error": "%s"}`, err)
-			return
-		}
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "%s"}`, err)
+		return
 	}
 
 	_, err = h.pathService.CreateNewPath(task)
@@ -95,7 +295,10 @@ func (h *Handlers) DeleteTask(w http.ResponseWriter, r *http.Request) {
 
 	if taskId, contains := params["taskId"]; contains {
 		count, err := h.taskService.UpdateTaskRequestsCount(taskId, -1)
-		if err != nil {
+		if err == pgx.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -105,7 +308,19 @@ func (h *Handlers) DeleteTask(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		h.taskService.DeleteAllTasksWithOrigin(taskId)
+		err = h.taskService.DeleteAllTasksWithOrigin(taskId)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "%s"}`, err)
+			return
+		}
+
+		err = h.pathService.UpdatePathStatusByTaskId(taskId, services.PathStatusCancelled)
+		if err != nil && err != pgx.ErrNoRows && !errors.Is(err, services.ErrIllegalTransition) {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error": "%s"}`, err)
+			return
+		}
 
 		w.WriteHeader(http.StatusOK)
 		return
@@ -117,7 +332,19 @@ func (h *Handlers) DeleteTask(w http.ResponseWriter, r *http.Request) {
 func (h *Handlers) GetPath(w http.ResponseWriter, r *http.Request) {
 	taskId := mux.Vars(r)["taskId"]
 
-	path, err := h.pathService.GetPathByTaskId(taskId)
+	wait, err := parseWait(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": "%s"}`, err)
+		return
+	}
+
+	var path *services.Path
+	if wait > 0 {
+		path, err = h.waitForPath(r.Context(), taskId, wait)
+	} else {
+		path, err = h.pathService.GetPathByTaskId(taskId)
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, `{"error": "%s"}`, err)
@@ -0,0 +1,51 @@
+package dbhandlers
+
+import (
+	"testing"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/internal/memservices"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/queue"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
+)
+
+type namedPlugin string
+
+func (p namedPlugin) GetName() string {
+	return string(p)
+}
+
+func (p namedPlugin) DoRequest(plugin.Request) (*plugin.Response, error) {
+	return &plugin.Response{}, nil
+}
+
+func (p namedPlugin) GetQueueConfig() queue.Config {
+	return queue.Config{}
+}
+
+func TestGenerateTaskIdDoesNotDependOnPluginOrder(t *testing.T) {
+	tasks := memservices.NewTaskService()
+	handlers := []*Handlers{
+		New(nil, tasks, nil, nil, []plugin.Plugin{namedPlugin("wikipedia"), namedPlugin("wiktionary")}),
+		New(nil, tasks, nil, nil, []plugin.Plugin{namedPlugin("wiktionary"), namedPlugin("wikipedia")}),
+	}
+
+	tests := []struct {
+		dataSource string
+		filter     services.LinkFilter
+		want       string
+	}{
+		{"wikipedia", services.LinkFilter{}, tasks.GenerateId("Albert_Einstein", "Physics")},
+		{"wiktionary", services.LinkFilter{}, tasks.GenerateId("wiktionary:Albert_Einstein", "Physics")},
+		{"wikipedia", services.LinkFilter{KeepRedirects: true}, tasks.GenerateId("Albert_Einstein", `Physics?{"keep_redirects":true}`)},
+	}
+
+	for _, test := range tests {
+		for i, h := range handlers {
+			got := h.generateTaskId(test.dataSource, test.filter, "Albert_Einstein", "Physics")
+			if got != test.want {
+				t.Errorf("handlers %d: id of %s %+v = %s, want %s", i, test.dataSource, test.filter, got, test.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package dbhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v4"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
+)
+
+const (
+	// pathPollInterval is how often a path is reloaded while a client waits
+	// for its changes.
+	pathPollInterval = time.Second
+	// maxWait bounds the ?wait= long-poll of GetPath.
+	maxWait = time.Minute
+)
+
+// PathProgress is a snapshot of a running search sent with progress events.
+type PathProgress struct {
+	Status        string `json:"status"`
+	PagesExpanded int    `json:"pages_expanded"`
+	FrontierSize  int    `json:"frontier_size"`
+	Depth         int    `json:"depth"`
+}
+
+func isSearchRunning(path *services.Path) bool {
+	return path.Status == services.PathStatusInProgress.String() ||
+		path.Status == services.PathStatusNotStarted.String()
+}
+
+func (h *Handlers) pathProgress(path *services.Path) (*PathProgress, error) {
+	frontierSize := 0
+	if isSearchRunning(path) {
+		count, err := h.taskService.CountTasksWithOrigin(path.TaskHash)
+		if err != nil {
+			return nil, err
+		}
+		frontierSize = count
+	}
+
+	return &PathProgress{
+		Status:        path.Status,
+		PagesExpanded: path.PagesExpanded,
+		FrontierSize:  frontierSize,
+		Depth:         path.SearchDepth,
+	}, nil
+}
+
+// parseWait reads the ?wait= duration of a long-poll request.
+func parseWait(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("wait")
+	if value == "" {
+		return 0, nil
+	}
+
+	wait, err := time.ParseDuration(value)
+	if err != nil || wait < 0 {
+		return 0, fmt.Errorf("invalid wait: %s", value)
+	}
+
+	if wait > maxWait {
+		wait = maxWait
+	}
+
+	return wait, nil
+}
+
+// waitForPath reloads the path until its search is over, wait elapses or the
+// client goes away, and returns the last loaded path.
+func (h *Handlers) waitForPath(ctx context.Context, taskId string, wait time.Duration) (*services.Path, error) {
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	ticker := time.NewTicker(pathPollInterval)
+	defer ticker.Stop()
+
+	for {
+		path, err := h.pathService.GetPathByTaskId(taskId)
+		if err != nil || !isSearchRunning(path) {
+			return path, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return path, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, data interface{}) error {
+	dataStr, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, dataStr)
+
+	return err
+}
+
+// GetPathEvents streams progress of a search as Server-Sent Events:
+//
+//	status   - {"status": "..."} when the path status changes
+//	progress - PathProgress when anything in it changes
+//	found    - the path with its full trace, the last event of a found search
+//	error    - {"error": "..."} when the progress can't be loaded
+//
+// The stream ends once the search is over or the client disconnects.
+func (h *Handlers) GetPathEvents(w http.ResponseWriter, r *http.Request) {
+	taskId := mux.Vars(r)["taskId"]
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "%s"}`, "streaming is not supported")
+		return
+	}
+
+	path, err := h.pathService.GetPathByTaskId(taskId)
+	if err == pgx.ErrNoRows {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "%s"}`, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(pathPollInterval)
+	defer ticker.Stop()
+
+	var last *PathProgress
+
+	for {
+		if err == nil {
+			last, err = h.writePathEvents(w, path, last)
+		}
+		if err != nil {
+			writeEvent(w, "error", map[string]string{"error": err.Error()})
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		if !isSearchRunning(path) {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		path, err = h.pathService.GetPathByTaskId(taskId)
+	}
+}
+
+// writePathEvents writes events describing what changed in path since last
+// and returns the current progress.
+func (h *Handlers) writePathEvents(w http.ResponseWriter, path *services.Path, last *PathProgress) (*PathProgress, error) {
+	progress, err := h.pathProgress(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if last == nil || last.Status != progress.Status {
+		err = writeEvent(w, "status", map[string]string{"status": progress.Status})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if last == nil || *last != *progress {
+		err = writeEvent(w, "progress", progress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if path.Status != services.PathStatusFound.String() {
+		return progress, nil
+	}
+
+	if path.Trace == "" {
+		path, err = h.pathService.BuildFullTraceAndUpdate(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return progress, writeEvent(w, "found", path)
+}
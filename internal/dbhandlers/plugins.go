@@ -0,0 +1,40 @@
+package dbhandlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+)
+
+// PluginInfo describes a registered plugin.
+type PluginInfo struct {
+	Name string `json:"name"`
+	// Default tells the plugin searches tasks that don't name a data source.
+	Default      bool                `json:"default"`
+	Capabilities plugin.Capabilities `json:"capabilities"`
+}
+
+// GetPlugins lists the registered plugins, i.e. the data sources tasks can be
+// created for, and their capabilities.
+func (h *Handlers) GetPlugins(w http.ResponseWriter, r *http.Request) {
+	plugins := make([]PluginInfo, 0, len(h.plugins))
+	for i, p := range h.plugins {
+		plugins = append(plugins, PluginInfo{
+			Name:         p.GetName(),
+			Default:      i == 0,
+			Capabilities: plugin.GetCapabilities(p),
+		})
+	}
+
+	pluginsStr, err := json.Marshal(plugins)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error": "%s"}`, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"plugins": %s}`, pluginsStr)
+}
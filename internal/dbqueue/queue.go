@@ -0,0 +1,268 @@
+package dbqueue
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	aqueue "github.com/malcolmmadsheep/handshakes-seeker/pkg/queue"
+)
+
+// pollInterval is how long a consumer or a producer waiting for room sleeps
+// before asking the database again.
+const pollInterval = time.Second
+
+const defaultVisibilityTimeout = time.Minute
+
+// Queue is an aqueue.Queue kept in the queue_messages table, so published
+// tasks survive restarts. A delivered task stays invisible while the instance
+// holding it is alive, however long it waits for its turn or is processed. It
+// is delivered again once it's nacked or within the visibility timeout after
+// the instance dies.
+type Queue struct {
+	conn              *pgxpool.Pool
+	name              string
+	config            aqueue.Config
+	visibilityTimeout time.Duration
+
+	stopConsumingCh chan struct{}
+	stopOnce        sync.Once
+}
+
+func New(conn *pgxpool.Pool, name string, config aqueue.Config, visibilityTimeout time.Duration) *Queue {
+	if visibilityTimeout <= 0 {
+		visibilityTimeout = defaultVisibilityTimeout
+	}
+
+	return &Queue{
+		conn:              conn,
+		name:              name,
+		config:            config,
+		visibilityTimeout: visibilityTimeout,
+		stopConsumingCh:   make(chan struct{}),
+	}
+}
+
+const countMessagesSQL = `
+select count(*)
+from queue_messages
+where queue = $1;
+`
+
+// publishMessageSQL identifies messages by their payload, so a task published
+// again while it's still in the queue isn't duplicated.
+const publishMessageSQL = `
+insert into queue_messages (queue, id, payload)
+values ($1, md5($2::bytea), $2::bytea)
+on conflict (queue, id) do nothing;
+`
+
+// Publish blocks while the queue holds QueueSize tasks or more. The limit is
+// checked before inserting, so concurrent producers may overshoot it slightly.
+func (q *Queue) Publish(ctx context.Context, task aqueue.Task) error {
+	for q.config.QueueSize > 0 {
+		var count int
+		err := q.conn.QueryRow(ctx, countMessagesSQL, q.name).Scan(&count)
+		if err != nil {
+			return err
+		}
+
+		if uint(count) < q.config.QueueSize {
+			break
+		}
+
+		if !sleep(ctx, nil, pollInterval) {
+			return ctx.Err()
+		}
+	}
+
+	_, err := q.conn.Exec(ctx, publishMessageSQL, q.name, []byte(task))
+
+	return err
+}
+
+func (q *Queue) StopConsuming() {
+	q.stopOnce.Do(func() {
+		close(q.stopConsumingCh)
+	})
+}
+
+// Drain returns nothing, undelivered tasks stay in the table.
+func (q *Queue) Drain() []aqueue.Task {
+	return nil
+}
+
+const receiveMessageSQL = `
+update queue_messages
+set visible_at = now() + make_interval(secs => $2), deliveries = deliveries + 1
+where (queue, id) = (
+	select queue, id
+	from queue_messages
+	where queue = $1 and visible_at <= now()
+	order by created_at
+	limit 1
+	for update skip locked
+)
+returning id, payload;
+`
+
+const ackMessageSQL = `
+delete from queue_messages
+where queue = $1 and id = $2;
+`
+
+const extendMessageSQL = `
+update queue_messages
+set visible_at = now() + make_interval(secs => $3)
+where queue = $1 and id = $2;
+`
+
+const nackMessageSQL = `
+update queue_messages
+set visible_at = now()
+where queue = $1 and id = $2;
+`
+
+func (q *Queue) ack(id string) error {
+	_, err := q.conn.Exec(context.Background(), ackMessageSQL, q.name, id)
+
+	return err
+}
+
+func (q *Queue) nack(id string) error {
+	_, err := q.conn.Exec(context.Background(), nackMessageSQL, q.name, id)
+
+	return err
+}
+
+// heldMessage is a delivered message that isn't acked or nacked yet.
+type heldMessage struct {
+	queue *Queue
+	id    string
+
+	mu       sync.Mutex
+	released bool
+	stopCh   chan struct{}
+}
+
+// keepInvisible extends the visibility timeout of the message every third of
+// it until the message is released.
+func (m *heldMessage) keepInvisible() {
+	ticker := time.NewTicker(m.queue.visibilityTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		m.mu.Lock()
+		if !m.released {
+			_, err := m.queue.conn.Exec(context.Background(), extendMessageSQL, m.queue.name, m.id, m.queue.visibilityTimeout.Seconds())
+			if err != nil {
+				log.Printf("dbqueue: queue %s: extending %s: %s\n", m.queue.name, m.id, err)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// release stops extending the visibility timeout and acks or nacks the
+// message. Extensions in flight finish first, so a nacked message isn't
+// hidden again.
+func (m *heldMessage) release(settle func(id string) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.released {
+		m.released = true
+		close(m.stopCh)
+	}
+
+	return settle(m.id)
+}
+
+// receive leases the earliest visible message. It returns nil if there is
+// none.
+func (q *Queue) receive(ctx context.Context) (*aqueue.Delivery, error) {
+	var (
+		id      string
+		payload []byte
+	)
+
+	err := q.conn.QueryRow(
+		ctx,
+		receiveMessageSQL,
+		q.name,
+		q.visibilityTimeout.Seconds(),
+	).Scan(&id, &payload)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	message := &heldMessage{
+		queue:  q,
+		id:     id,
+		stopCh: make(chan struct{}),
+	}
+	go message.keepInvisible()
+
+	return aqueue.NewDelivery(
+		payload,
+		func() error { return message.release(q.ack) },
+		func() error { return message.release(q.nack) },
+	), nil
+}
+
+func (q *Queue) StartConsuming(ctx context.Context) <-chan *aqueue.Delivery {
+	consumeChan := make(chan *aqueue.Delivery)
+
+	go func() {
+		defer close(consumeChan)
+
+		for ctx.Err() == nil {
+			delivery, err := q.receive(ctx)
+			if err != nil {
+				log.Printf("dbqueue: queue %s: %s\n", q.name, err)
+			}
+			if delivery == nil {
+				if !sleep(ctx, q.stopConsumingCh, pollInterval) {
+					return
+				}
+				continue
+			}
+
+			select {
+			case consumeChan <- delivery:
+			case <-ctx.Done():
+				delivery.Nack()
+				return
+			case <-q.stopConsumingCh:
+				delivery.Nack()
+				return
+			}
+		}
+	}()
+
+	return consumeChan
+}
+
+// sleep pauses for d and reports whether ctx is still alive and stopCh is
+// still open afterwards.
+func sleep(ctx context.Context, stopCh <-chan struct{}, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-stopCh:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,109 @@
+package dbservices
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
+)
+
+type DeadLetterService struct {
+	conn *pgxpool.Pool
+}
+
+func NewDeadLetterService(conn *pgxpool.Pool) *DeadLetterService {
+	return &DeadLetterService{
+		conn,
+	}
+}
+
+func scanDeadLetter(row pgx.Row) (*services.DeadLetter, error) {
+	deadLetter := services.DeadLetter{}
+
+	var task []byte
+	err := row.Scan(&deadLetter.Id, &task, &deadLetter.Error, &deadLetter.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(task, &deadLetter.Task)
+	if err != nil {
+		return nil, err
+	}
+
+	return &deadLetter, nil
+}
+
+const createDeadLetterSQL = `
+insert into dead_letters (task_id, origin_task_id, task, error)
+values ($1, $2, $3, $4)
+returning id, task, error, created_at;
+`
+
+func (ds *DeadLetterService) CreateDeadLetter(task *services.Task, reason string) (*services.DeadLetter, error) {
+	taskStr, err := json.Marshal(task)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDeadLetter(ds.conn.QueryRow(
+		context.Background(),
+		createDeadLetterSQL,
+		task.Id,
+		task.OriginTaskId,
+		taskStr,
+		reason,
+	))
+}
+
+const getDeadLettersSQL = `
+select id, task, error, created_at
+from dead_letters
+order by id
+limit $1
+offset $2;
+`
+
+func (ds *DeadLetterService) GetDeadLetters(limit, offset uint) ([]*services.DeadLetter, error) {
+	rows, err := ds.conn.Query(context.Background(), getDeadLettersSQL, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deadLetters := make([]*services.DeadLetter, 0, limit)
+
+	for rows.Next() {
+		deadLetter, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		deadLetters = append(deadLetters, deadLetter)
+	}
+
+	return deadLetters, rows.Err()
+}
+
+const getDeadLetterByIdSQL = `
+select id, task, error, created_at
+from dead_letters
+where id = $1;
+`
+
+func (ds *DeadLetterService) GetDeadLetterById(id uint) (*services.DeadLetter, error) {
+	return scanDeadLetter(ds.conn.QueryRow(context.Background(), getDeadLetterByIdSQL, id))
+}
+
+const deleteDeadLetterByIdSQL = `
+delete from dead_letters
+where id = $1;
+`
+
+func (ds *DeadLetterService) DeleteDeadLetterById(id uint) error {
+	_, err := ds.conn.Exec(context.Background(), deleteDeadLetterByIdSQL, id)
+
+	return err
+}
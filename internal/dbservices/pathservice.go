@@ -2,8 +2,6 @@ package dbservices
 
 import (
 	"context"
-	"fmt"
-	"strings"
 
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -20,25 +18,26 @@ func NewPathService(conn *pgxpool.Pool) *PathService {
 	}
 }
 
-const getPathByTaskIdSQL = `
-select id, source_url, destination_url, status, trace
-from paths
-where task_hash = $1;
-`
+const pathColumns = `id, data_source, task_hash, origin_task_hash, parent_task_hash, direction, depth, source_url, destination_url, status, trace, pages_expanded, search_depth, generation`
 
-func (ps *PathService) GetPathByTaskId(taskId string) (*services.Path, error) {
+func scanPath(row pgx.Row) (*services.Path, error) {
 	path := services.Path{}
 
-	err := ps.conn.QueryRow(
-		context.Background(),
-		getPathByTaskIdSQL,
-		taskId,
-	).Scan(
+	err := row.Scan(
 		&path.Id,
+		&path.DataSource,
+		&path.TaskHash,
+		&path.OriginTaskHash,
+		&path.ParentTaskHash,
+		&path.Direction,
+		&path.Depth,
 		&path.SourceUrl,
 		&path.DestUrl,
 		&path.Status,
 		&path.Trace,
+		&path.PagesExpanded,
+		&path.SearchDepth,
+		&path.Generation,
 	)
 	if err != nil {
 		return nil, err
@@ -47,13 +46,59 @@ func (ps *PathService) GetPathByTaskId(taskId string) (*services.Path, error) {
 	return &path, nil
 }
 
+func scanPaths(rows pgx.Rows) ([]*services.Path, error) {
+	defer rows.Close()
+
+	paths := make([]*services.Path, 0)
+
+	for rows.Next() {
+		path, err := scanPath(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, rows.Err()
+}
+
+const getPathByTaskIdSQL = `
+select ` + pathColumns + `
+from paths
+where task_hash = $1;
+`
+
+func (ps *PathService) GetPathByTaskId(taskId string) (*services.Path, error) {
+	return scanPath(ps.conn.QueryRow(context.Background(), getPathByTaskIdSQL, taskId))
+}
+
+const getPathsByTaskIdsSQL = `
+select ` + pathColumns + `
+from paths
+where task_hash = any($1);
+`
+
+func (ps *PathService) GetPathsByTaskIds(taskIds []string) ([]*services.Path, error) {
+	if len(taskIds) == 0 {
+		return []*services.Path{}, nil
+	}
+
+	rows, err := ps.conn.Query(context.Background(), getPathsByTaskIdsSQL, taskIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanPaths(rows)
+}
+
 const createNewPathSQL = `
 insert into paths (data_source, task_hash, source_url, destination_url, status, trace)
 values ($1, $2, $3, $4, $5, $6)
 returning id;
 `
 
-func (ps *PathService) createNewPath(taskId, sourceUrl, destUrl, trace string, status services.PathStatus) (*services.Path, error) {
+func (ps *PathService) createNewPath(dataSource, taskId, sourceUrl, destUrl, trace string, status services.PathStatus) (*services.Path, error) {
 	path, err := ps.GetPathByTaskId(taskId)
 	if err == nil {
 		return path, nil
@@ -62,18 +107,19 @@ func (ps *PathService) createNewPath(taskId, sourceUrl, destUrl, trace string, s
 	}
 
 	newPath := services.Path{
-		SourceUrl: sourceUrl,
-		DestUrl:   destUrl,
-		Status:    status.String(),
-		TaskHash:  taskId,
-		Trace:     trace,
+		DataSource: dataSource,
+		SourceUrl:  sourceUrl,
+		DestUrl:    destUrl,
+		Status:     status.String(),
+		TaskHash:   taskId,
+		Trace:      trace,
 	}
 
 	var id uint = 0
 	err = ps.conn.QueryRow(
 		context.Background(),
 		createNewPathSQL,
-		"",
+		newPath.DataSource,
 		newPath.TaskHash,
 		newPath.SourceUrl,
 		newPath.DestUrl,
@@ -90,54 +136,241 @@ func (ps *PathService) createNewPath(taskId, sourceUrl, destUrl, trace string, s
 }
 
 func (ps *PathService) CreateNewPath(task *services.Task) (*services.Path, error) {
-	return ps.createNewPath(task.Id, task.SourceUrl, task.DestUrl, "", services.PathStatusInProgress)
+	return ps.createNewPath(task.DataSource, task.Id, task.SourceUrl, task.DestUrl, "", services.PathStatusInProgress)
+}
+
+func statusStrings(statuses []services.PathStatus) []string {
+	strs := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		strs = append(strs, status.String())
+	}
+
+	return strs
+}
+
+// transitionError explains why a conditional status update matched no rows:
+// either the path doesn't exist or its current status can't go to status.
+func (ps *PathService) transitionError(taskId string, status services.PathStatus) error {
+	path, err := ps.GetPathByTaskId(taskId)
+	if err != nil {
+		return err
+	}
+
+	from, err := services.ParsePathStatus(path.Status)
+	if err != nil {
+		return err
+	}
+
+	return &services.TransitionError{TaskId: taskId, From: from, To: status}
 }
 
 const updatePathStatusSQL = `
 update paths
 set status = $1
-where task_hash = $2;
+where task_hash = $2 and status = any($3::path_status[]);
 `
 
 func (ps *PathService) UpdatePathStatusByTaskId(taskId string, status services.PathStatus) error {
-	_, err := ps.conn.Exec(context.Background(), updatePathStatusSQL, status.String(), taskId)
+	tag, err := ps.conn.Exec(
+		context.Background(),
+		updatePathStatusSQL,
+		status.String(),
+		taskId,
+		statusStrings(services.TransitionSources(status)),
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ps.transitionError(taskId, status)
+	}
+
+	return nil
+}
+
+const resetPathSQL = `
+update paths
+set status = $1, trace = '', pages_expanded = 0, search_depth = 0, generation = generation + 1
+where task_hash = $2 and status = any($3::path_status[]);
+`
+
+const deletePathsWithOriginSQL = `
+delete from paths
+where origin_task_hash = $1;
+`
+
+func (ps *PathService) ResetPathByTaskId(taskId string) error {
+	tx, err := ps.conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	tag, err := tx.Exec(
+		context.Background(),
+		resetPathSQL,
+		services.PathStatusInProgress.String(),
+		taskId,
+		statusStrings(services.RestartSources()),
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ps.transitionError(taskId, services.PathStatusInProgress)
+	}
+
+	_, err = tx.Exec(context.Background(), deletePathsWithOriginSQL, taskId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+const recordProgressSQL = `
+update paths
+set pages_expanded = pages_expanded + 1, search_depth = greatest(search_depth, $2)
+where task_hash = $1;
+`
+
+func (ps *PathService) RecordProgress(taskId string, depth int) error {
+	_, err := ps.conn.Exec(context.Background(), recordProgressSQL, taskId, depth)
 
 	return err
 }
 
-func (ps *PathService) CreateFoundPath(taskId, sourceUrl, destUrl, trace string) (*services.Path, error) {
-	return ps.createNewPath(taskId, sourceUrl, destUrl, trace, services.PathStatusFound)
+func (ps *PathService) CreateFoundPath(dataSource, taskId, sourceUrl, destUrl, trace string) (*services.Path, error) {
+	return ps.createNewPath(dataSource, taskId, sourceUrl, destUrl, trace, services.PathStatusFound)
 }
 
+// lockSearchSQL reads the state of the search of an origin path and keeps
+// it from being reset until the transaction ends.
+const lockSearchSQL = `
+select status, generation
+from paths
+where task_hash = $1
+for share;
+`
+
+const bulkCreateFoundPathSQL = `
+insert into paths (data_source, task_hash, origin_task_hash, parent_task_hash, direction, depth, source_url, destination_url, status, trace, generation)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+on conflict (task_hash) do nothing;
+`
+
 func (ps *PathService) BulkCreateFoundPaths(shapes []services.PathShapeForBulk) error {
-	sb := strings.Builder{}
+	if len(shapes) == 0 {
+		return nil
+	}
+
+	tx, err := ps.conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	var (
+		status     string
+		generation int
+	)
+	err = tx.QueryRow(context.Background(), lockSearchSQL, shapes[0].OriginTaskId).Scan(&status, &generation)
+	if err == pgx.ErrNoRows {
+		return services.ErrStaleSearch
+	} else if err != nil {
+		return err
+	}
+	if status != services.PathStatusInProgress.String() || generation != shapes[0].Generation {
+		return services.ErrStaleSearch
+	}
 
-	sb.WriteString("insert into paths (task_hash, source_url, destination_url, status, trace) values ($1, $2, $3, $4, $5)")
+	batch := &pgx.Batch{}
 
 	for _, shape := range shapes {
-		sb.WriteString(fmt.Sprintf(`(%s, %s, %s, %s, %s)`, shape.TaskId, shape.SourceUrl, shape.DestUrl, services.PathStatusFound, shape.Trace))
+		direction := shape.Direction
+		if direction == "" {
+			direction = services.TaskDirectionForward
+		}
+
+		batch.Queue(
+			bulkCreateFoundPathSQL,
+			shape.DataSource,
+			shape.TaskId,
+			shape.OriginTaskId,
+			shape.ParentTaskId,
+			direction,
+			shape.Depth,
+			shape.SourceUrl,
+			shape.DestUrl,
+			services.PathStatusFound.String(),
+			shape.Trace,
+			shape.Generation,
+		)
 	}
 
-	_, err := ps.conn.Exec(context.Background(), sb.String())
+	results := tx.SendBatch(context.Background(), batch)
+	for range shapes {
+		if _, err := results.Exec(); err != nil {
+			results.Close()
+			return err
+		}
+	}
 
-	return err
+	err = results.Close()
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
 }
 
-const buildPathRecursivelySQL = `
-WITH RECURSIVE search AS (
-	SELECT source_url, destination_url,
-		   trace
+// getMeetingEdgesSQL picks the shortest pair of forward and backward edges
+// discovering the same node within a search.
+const getMeetingEdgesSQL = `
+select f.task_hash, b.task_hash
+from paths as f
+	join paths as b on b.origin_task_hash = f.origin_task_hash and b.source_url = f.destination_url
+where f.origin_task_hash = $1 and f.direction = 'forward' and b.direction = 'backward'
+order by f.depth + b.depth
+limit 1;
+`
+
+const getForwardEdgeToDestSQL = `
+select task_hash
+from paths
+where origin_task_hash = $1 and direction = 'forward' and destination_url = $2
+order by depth
+limit 1;
+`
+
+// getParentChainSQL walks parents of the given edge up to the root of its
+// search. Depth has to decrease on every step, so a chain never loops.
+const getParentChainSQL = `
+WITH RECURSIVE chain AS (
+	SELECT ` + pathColumns + `
 	FROM paths
-	WHERE source_url = $1
+	WHERE task_hash = $1 and origin_task_hash = $2
  UNION ALL
-	SELECT p.source_url, p.destination_url,
-		   search.trace || ',' || p.destination_url
+	SELECT p.id, p.data_source, p.task_hash, p.origin_task_hash, p.parent_task_hash, p.direction, p.depth,
+		   p.source_url, p.destination_url, p.status, p.trace, p.pages_expanded, p.search_depth, p.generation
 	FROM paths as p
-	   JOIN search ON p.source_url = search.destination_url
+	   JOIN chain ON p.task_hash = chain.parent_task_hash
+	WHERE p.origin_task_hash = $2 and p.depth < chain.depth
 )
-SELECT * FROM search where destination_url = $2 and trace != '' limit 1;
+SELECT * FROM chain order by depth desc;
 `
 
+func (ps *PathService) getParentChain(originTaskId, taskId string) ([]*services.Path, error) {
+	rows, err := ps.conn.Query(context.Background(), getParentChainSQL, taskId, originTaskId)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanPaths(rows)
+}
+
 const updatePathTraceSQL = `
 update paths
 set trace = $1
@@ -145,20 +378,40 @@ where id = $2;
 `
 
 func (ps *PathService) BuildFullTraceAndUpdate(path *services.Path) (*services.Path, error) {
+	var forwardTaskId, backwardTaskId string
+
 	err := ps.conn.QueryRow(
 		context.Background(),
-		buildPathRecursivelySQL,
-		path.SourceUrl,
-		path.DestUrl,
-	).Scan(
-		&path.SourceUrl,
-		&path.DestUrl,
-		&path.Trace,
-	)
+		getMeetingEdgesSQL,
+		path.TaskHash,
+	).Scan(&forwardTaskId, &backwardTaskId)
+	if err == pgx.ErrNoRows {
+		err = ps.conn.QueryRow(
+			context.Background(),
+			getForwardEdgeToDestSQL,
+			path.TaskHash,
+			path.DestUrl,
+		).Scan(&forwardTaskId)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	forward, err := ps.getParentChain(path.TaskHash, forwardTaskId)
+	if err != nil {
+		return nil, err
+	}
+
+	backward := []*services.Path{}
+	if backwardTaskId != "" {
+		backward, err = ps.getParentChain(path.TaskHash, backwardTaskId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	path.Trace = services.JoinTrace(forward, backward)
+
 	_, err = ps.conn.Exec(context.Background(), updatePathTraceSQL, path.Trace, path.Id)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,75 @@
+package dbservices
+
+import (
+	"sync"
+	"time"
+)
+
+type cachedRequestsCount struct {
+	count     int
+	expiresAt time.Time
+}
+
+// requestsCountCache keeps recently read requests counts, so ShouldSkipTask
+// doesn't hit the database for every task. Entries expire after ttl, which
+// bounds the time a cancellation made by another instance stays unnoticed.
+// Expired entries are swept once per ttl, so the cache holds only origins
+// checked lately.
+type requestsCountCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]cachedRequestsCount
+	lastSweep time.Time
+}
+
+func newRequestsCountCache(ttl time.Duration) *requestsCountCache {
+	return &requestsCountCache{
+		ttl:       ttl,
+		entries:   make(map[string]cachedRequestsCount),
+		lastSweep: time.Now(),
+	}
+}
+
+func (c *requestsCountCache) get(originTaskId string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, contains := c.entries[originTaskId]
+	if !contains {
+		return 0, false
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, originTaskId)
+		return 0, false
+	}
+
+	return entry.count, true
+}
+
+func (c *requestsCountCache) set(originTaskId string, count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) >= c.ttl {
+		for id, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	c.entries[originTaskId] = cachedRequestsCount{
+		count:     count,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+func (c *requestsCountCache) invalidate(originTaskId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, originTaskId)
+}
@@ -0,0 +1,32 @@
+package dbservices
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRequestsCountCacheSweepsExpiredEntries(t *testing.T) {
+	ttl := 20 * time.Millisecond
+	cache := newRequestsCountCache(ttl)
+
+	for i := 0; i < 100; i++ {
+		cache.set(fmt.Sprint(i), i)
+	}
+	if count, contains := cache.get("42"); !contains || count != 42 {
+		t.Fatalf("get = %d, %t, want 42, true", count, contains)
+	}
+
+	time.Sleep(2 * ttl)
+	cache.set("fresh", 1)
+
+	if len(cache.entries) != 1 {
+		t.Errorf("%d entries after the others expired, want 1", len(cache.entries))
+	}
+	if _, contains := cache.get("42"); contains {
+		t.Error("got an expired entry")
+	}
+	if count, contains := cache.get("fresh"); !contains || count != 1 {
+		t.Errorf("get = %d, %t, want 1, true", count, contains)
+	}
+}
@@ -2,8 +2,9 @@ package dbservices
 
 import (
 	"context"
+	"encoding/json"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -11,33 +12,48 @@ import (
 	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
 )
 
+const requestsCountCacheTTL = 2 * time.Second
+
 type TaskService struct {
-	conn        *pgxpool.Pool
-	skipTaskMap sync.Map
+	conn          *pgxpool.Pool
+	requestsCache *requestsCountCache
 }
 
 func NewTaskService(conn *pgxpool.Pool) *TaskService {
 	return &TaskService{
-		conn:        conn,
-		skipTaskMap: sync.Map{},
+		conn:          conn,
+		requestsCache: newRequestsCountCache(requestsCountCacheTTL),
 	}
 }
 
 func scanTask(row pgx.Row) (*services.Task, error) {
 	task := services.Task{}
 
+	var filter []byte
 	err := row.Scan(
 		&task.Id,
 		&task.OriginTaskId,
+		&task.ParentTaskId,
 		&task.DataSource,
 		&task.SourceUrl,
 		&task.DestUrl,
 		&task.Cursor,
+		&task.Direction,
+		&task.Depth,
+		&task.MaxDepth,
+		&task.Attempts,
+		&filter,
+		&task.Generation,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	err = json.Unmarshal(filter, &task.Filter)
+	if err != nil {
+		return nil, err
+	}
+
 	return &task, nil
 }
 
@@ -47,32 +63,30 @@ func (ts *TaskService) CutUrlTitle(url string) string {
 	return parts[len(parts)-1]
 }
 
-func (ts *TaskService) ShouldSkipTask(task *services.Task) bool {
-	count, contains := ts.skipTaskMap.Load(task.OriginTaskId)
-
-	return contains && count.(int) <= 0
-}
-
-func (ts *TaskService) addTaskCount(id string, n int) int {
-	count, _ := ts.skipTaskMap.Load(id)
+const getRequestsCountSQL = `
+select requests_count
+from search_requests
+where origin_task_id = $1;
+`
 
-	if count == nil {
-		ts.skipTaskMap.Store(id, n)
-		return n
+// ShouldSkipTask reports whether everybody who requested the search of the
+// task origin has cancelled it. Counts are cached for a short time, local
+// updates invalidate the cache right away.
+func (ts *TaskService) ShouldSkipTask(task *services.Task) bool {
+	if count, contains := ts.requestsCache.get(task.OriginTaskId); contains {
+		return count <= 0
 	}
 
-	newCount := count.(int) + n
-	ts.skipTaskMap.Store(id, newCount)
+	count := 0
 
-	return newCount
-}
+	err := ts.conn.QueryRow(context.Background(), getRequestsCountSQL, task.OriginTaskId).Scan(&count)
+	if err != nil {
+		return false
+	}
 
-func (ts *TaskService) incrementTaskCount(id string) int {
-	return ts.addTaskCount(id, 1)
-}
+	ts.requestsCache.set(task.OriginTaskId, count)
 
-func (ts *TaskService) decrementTaskCount(id string) int {
-	return ts.addTaskCount(id, -1)
+	return count <= 0
 }
 
 func (ts *TaskService) GenerateId(sourceUrl, destUrl string) string {
@@ -80,9 +94,11 @@ func (ts *TaskService) GenerateId(sourceUrl, destUrl string) string {
 }
 
 const getTaskByIdSQL = `
-select id, origin_task_id, data_source, source_url, dest_url, cursor, requests_count
-from tasks_queue
-where id = $1;
+select t.id, t.origin_task_id, t.parent_task_id, t.data_source, t.source_url, t.dest_url, t.cursor,
+	coalesce(r.requests_count, 0), t.direction, t.depth, t.max_depth, t.attempts, t.link_filter, t.generation
+from tasks_queue as t
+	left join search_requests as r on r.origin_task_id = t.origin_task_id
+where t.id = $1;
 `
 
 func (ts *TaskService) GetTaskById(id string) (*services.Task, error) {
@@ -90,6 +106,7 @@ func (ts *TaskService) GetTaskById(id string) (*services.Task, error) {
 		Id: id,
 	}
 
+	var filter []byte
 	err := ts.conn.QueryRow(
 		context.Background(),
 		getTaskByIdSQL,
@@ -97,27 +114,41 @@ func (ts *TaskService) GetTaskById(id string) (*services.Task, error) {
 	).Scan(
 		&task.Id,
 		&task.OriginTaskId,
+		&task.ParentTaskId,
 		&task.DataSource,
 		&task.SourceUrl,
 		&task.DestUrl,
 		&task.Cursor,
 		&task.RequestsCount,
+		&task.Direction,
+		&task.Depth,
+		&task.MaxDepth,
+		&task.Attempts,
+		&filter,
+		&task.Generation,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	err = json.Unmarshal(filter, &task.Filter)
+	if err != nil {
+		return nil, err
+	}
+
 	return &task, nil
 }
 
 const updateTaskRequestCountSQL = `
-UPDATE tasks_queue
-set requests_count = requests_count + $1
+UPDATE search_requests
+set requests_count = greatest(requests_count + $1, 0), updated_at = current_timestamp
 where origin_task_id = $2
-RETURNING requests_count;	
+RETURNING requests_count;
 `
 
 func (ts *TaskService) UpdateTaskRequestsCount(originTaskId string, n int) (int, error) {
+	ts.requestsCache.invalidate(originTaskId)
+
 	count := 0
 
 	err := ts.conn.QueryRow(context.Background(), updateTaskRequestCountSQL, n, originTaskId).Scan(&count)
@@ -128,54 +159,93 @@ func (ts *TaskService) UpdateTaskRequestsCount(originTaskId string, n int) (int,
 	return count, nil
 }
 
+const addSearchRequestsSQL = `
+INSERT INTO search_requests (origin_task_id, requests_count)
+VALUES ($1, $2)
+ON CONFLICT (origin_task_id) DO UPDATE
+SET requests_count = search_requests.requests_count + excluded.requests_count, updated_at = current_timestamp;
+`
+
 const createTaskSQL = `
-INSERT INTO tasks_queue (id, origin_task_id, data_source, source_url, dest_url, cursor, requests_count)
-VALUES ($1, $2, $3, $4, $5, $6, $7);
+INSERT INTO tasks_queue (id, origin_task_id, parent_task_id, data_source, source_url, dest_url, cursor, requests_count, direction, depth, max_depth, link_filter, generation)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+ON CONFLICT (id) DO NOTHING;
 `
 
-func (ts *TaskService) CreateNewTask(id, originTaskId, sourceUrl, destUrl, cursor string, requestsCount int) (*services.Task, error) {
-	task, err := ts.GetTaskById(id)
+func (ts *TaskService) CreateNewTask(newTask *services.Task) (*services.Task, error) {
+	task, err := ts.GetTaskById(newTask.Id)
 	if err == nil {
 		return task, nil
 	}
 
+	direction := newTask.Direction
+	if direction == "" {
+		direction = services.TaskDirectionForward
+	}
+
+	filter, err := json.Marshal(newTask.Filter)
+	if err != nil {
+		return nil, err
+	}
+
 	_, err = ts.conn.Exec(
 		context.Background(),
 		createTaskSQL,
-		id,
-		originTaskId,
-		"",
-		sourceUrl,
-		destUrl,
-		cursor,
-		requestsCount,
+		newTask.Id,
+		newTask.OriginTaskId,
+		newTask.ParentTaskId,
+		newTask.DataSource,
+		newTask.SourceUrl,
+		newTask.DestUrl,
+		newTask.Cursor,
+		newTask.RequestsCount,
+		direction,
+		newTask.Depth,
+		newTask.MaxDepth,
+		filter,
+		newTask.Generation,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	ts.incrementTaskCount(id)
+	if newTask.Id == newTask.OriginTaskId {
+		ts.requestsCache.invalidate(newTask.OriginTaskId)
+
+		_, err = ts.conn.Exec(context.Background(), addSearchRequestsSQL, newTask.OriginTaskId, newTask.RequestsCount)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return &services.Task{
-		Id:           id,
-		OriginTaskId: originTaskId,
-		SourceUrl:    sourceUrl,
-		DestUrl:      destUrl,
-		Cursor:       cursor,
+		Id:           newTask.Id,
+		OriginTaskId: newTask.OriginTaskId,
+		ParentTaskId: newTask.ParentTaskId,
+		DataSource:   newTask.DataSource,
+		SourceUrl:    newTask.SourceUrl,
+		DestUrl:      newTask.DestUrl,
+		Cursor:       newTask.Cursor,
+		Direction:    direction,
+		Depth:        newTask.Depth,
+		MaxDepth:     newTask.MaxDepth,
+		Filter:       newTask.Filter,
+		Generation:   newTask.Generation,
 	}, nil
 }
 
 const getNEarliestTasksSQL = `
-select id, origin_task_id, data_source, source_url, dest_url, cursor 
+select id, origin_task_id, parent_task_id, data_source, source_url, dest_url, cursor, direction, depth, max_depth, attempts, link_filter, generation
 from tasks_queue
+where data_source = $1
 order by created_at
-limit $1;
+limit $2;
 `
 
-func (ts *TaskService) GetNEarliestTasks(n uint) ([]*services.Task, error) {
+func (ts *TaskService) GetNEarliestTasks(dataSource string, n uint) ([]*services.Task, error) {
 	tasks := make([]*services.Task, 0, n)
 
-	rows, err := ts.conn.Query(context.Background(), getNEarliestTasksSQL, n)
+	rows, err := ts.conn.Query(context.Background(), getNEarliestTasksSQL, dataSource, n)
 	if err != nil {
 		return nil, err
 	}
@@ -192,13 +262,84 @@ func (ts *TaskService) GetNEarliestTasks(n uint) ([]*services.Task, error) {
 	return tasks, nil
 }
 
+const claimNEarliestTasksSQL = `
+update tasks_queue
+set lease_owner = $1, lease_expires_at = now() + make_interval(secs => $4)
+where id in (
+	select id
+	from tasks_queue
+	where data_source = $2 and (lease_expires_at is null or lease_expires_at < now())
+	order by created_at
+	limit $3
+	for update skip locked
+)
+returning id, origin_task_id, parent_task_id, data_source, source_url, dest_url, cursor, direction, depth, max_depth, attempts, link_filter, generation;
+`
+
+func (ts *TaskService) ClaimNEarliestTasks(owner, dataSource string, n uint, lease time.Duration) ([]*services.Task, error) {
+	tasks := make([]*services.Task, 0, n)
+
+	rows, err := ts.conn.Query(context.Background(), claimNEarliestTasksSQL, owner, dataSource, n, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+const releaseTasksSQL = `
+update tasks_queue
+set lease_owner = null, lease_expires_at = null
+where lease_owner = $1;
+`
+
+func (ts *TaskService) ReleaseTasks(owner string) error {
+	_, err := ts.conn.Exec(context.Background(), releaseTasksSQL, owner)
+
+	return err
+}
+
+const retryTaskSQL = `
+update tasks_queue
+set attempts = attempts + 1, lease_owner = null, lease_expires_at = now() + make_interval(secs => $2)
+where id = $1;
+`
+
+func (ts *TaskService) RetryTask(id string, delay time.Duration) error {
+	_, err := ts.conn.Exec(context.Background(), retryTaskSQL, id, delay.Seconds())
+
+	return err
+}
+
+const postponeTaskSQL = `
+update tasks_queue
+set lease_owner = null, lease_expires_at = now() + make_interval(secs => $2)
+where id = $1;
+`
+
+func (ts *TaskService) PostponeTask(id string, delay time.Duration) error {
+	_, err := ts.conn.Exec(context.Background(), postponeTaskSQL, id, delay.Seconds())
+
+	return err
+}
+
 const deleteTaskByIdSQL = `
 delete from tasks_queue
-where id = $1 and origin_task_id = $2;
+where id = $1 and origin_task_id = $2 and generation = $3;
 `
 
-func (ts *TaskService) DeleteTaskByIds(id string, originId string) error {
-	_, err := ts.conn.Exec(context.Background(), deleteTaskByIdSQL, id, originId)
+func (ts *TaskService) DeleteTaskByIds(id string, originId string, generation int) error {
+	_, err := ts.conn.Exec(context.Background(), deleteTaskByIdSQL, id, originId, generation)
 
 	return err
 }
@@ -209,10 +350,6 @@ where origin_task_id = $1;
 `
 
 func (ts *TaskService) DeleteAllTasksWithOrigin(originId string) error {
-	if ts.decrementTaskCount(originId) > 0 {
-		return nil
-	}
-
 	_, err := ts.conn.Exec(context.Background(), deleteAllTasksByOriginIdSQL, originId)
 	if err != nil {
 		return err
@@ -220,3 +357,20 @@ func (ts *TaskService) DeleteAllTasksWithOrigin(originId string) error {
 
 	return nil
 }
+
+const countTasksWithOriginSQL = `
+select count(*)
+from tasks_queue
+where origin_task_id = $1;
+`
+
+func (ts *TaskService) CountTasksWithOrigin(originId string) (int, error) {
+	count := 0
+
+	err := ts.conn.QueryRow(context.Background(), countTasksWithOriginSQL, originId).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
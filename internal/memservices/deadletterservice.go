@@ -0,0 +1,89 @@
+package memservices
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
+)
+
+// DeadLetterService is an in-memory services.DeadLetterService.
+type DeadLetterService struct {
+	mu          sync.Mutex
+	deadLetters []*services.DeadLetter
+	nextId      uint
+}
+
+func NewDeadLetterService() *DeadLetterService {
+	return &DeadLetterService{
+		deadLetters: make([]*services.DeadLetter, 0),
+		nextId:      1,
+	}
+}
+
+func copyDeadLetter(deadLetter *services.DeadLetter) *services.DeadLetter {
+	deadLetterCopy := *deadLetter
+	task := *deadLetter.Task
+	deadLetterCopy.Task = &task
+
+	return &deadLetterCopy
+}
+
+func (ds *DeadLetterService) CreateDeadLetter(task *services.Task, reason string) (*services.DeadLetter, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	taskCopy := *task
+	deadLetter := &services.DeadLetter{
+		Id:        ds.nextId,
+		Task:      &taskCopy,
+		Error:     reason,
+		CreatedAt: time.Now(),
+	}
+	ds.nextId++
+
+	ds.deadLetters = append(ds.deadLetters, deadLetter)
+
+	return copyDeadLetter(deadLetter), nil
+}
+
+func (ds *DeadLetterService) GetDeadLetters(limit, offset uint) ([]*services.DeadLetter, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	deadLetters := make([]*services.DeadLetter, 0, limit)
+
+	for i := offset; i < uint(len(ds.deadLetters)) && uint(len(deadLetters)) < limit; i++ {
+		deadLetters = append(deadLetters, copyDeadLetter(ds.deadLetters[i]))
+	}
+
+	return deadLetters, nil
+}
+
+func (ds *DeadLetterService) GetDeadLetterById(id uint) (*services.DeadLetter, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	for _, deadLetter := range ds.deadLetters {
+		if deadLetter.Id == id {
+			return copyDeadLetter(deadLetter), nil
+		}
+	}
+
+	return nil, pgx.ErrNoRows
+}
+
+func (ds *DeadLetterService) DeleteDeadLetterById(id uint) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	for i, deadLetter := range ds.deadLetters {
+		if deadLetter.Id == id {
+			ds.deadLetters = append(ds.deadLetters[:i], ds.deadLetters[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
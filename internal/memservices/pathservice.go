@@ -0,0 +1,301 @@
+package memservices
+
+import (
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
+)
+
+// PathService is an in-memory services.PathService with the same semantics as
+// dbservices.PathService.
+type PathService struct {
+	mu     sync.Mutex
+	paths  []*services.Path
+	byHash map[string]*services.Path
+	nextId uint
+}
+
+func NewPathService() *PathService {
+	return &PathService{
+		paths:  make([]*services.Path, 0),
+		byHash: make(map[string]*services.Path),
+		nextId: 1,
+	}
+}
+
+func (ps *PathService) GetPathByTaskId(taskId string) (*services.Path, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	path, contains := ps.byHash[taskId]
+	if !contains {
+		return nil, pgx.ErrNoRows
+	}
+
+	pathCopy := *path
+
+	return &pathCopy, nil
+}
+
+func (ps *PathService) createNewPath(dataSource, taskId, sourceUrl, destUrl, trace string, status services.PathStatus) (*services.Path, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if path, contains := ps.byHash[taskId]; contains {
+		pathCopy := *path
+		return &pathCopy, nil
+	}
+
+	newPath := services.Path{
+		Id:         ps.nextId,
+		DataSource: dataSource,
+		SourceUrl:  sourceUrl,
+		DestUrl:    destUrl,
+		Status:     status.String(),
+		TaskHash:   taskId,
+		Trace:      trace,
+	}
+	ps.nextId++
+
+	stored := newPath
+	ps.paths = append(ps.paths, &stored)
+	ps.byHash[taskId] = &stored
+
+	return &newPath, nil
+}
+
+func (ps *PathService) CreateNewPath(task *services.Task) (*services.Path, error) {
+	return ps.createNewPath(task.DataSource, task.Id, task.SourceUrl, task.DestUrl, "", services.PathStatusInProgress)
+}
+
+// transition checks that the path can go to status from its current one.
+func (ps *PathService) transition(taskId string, status services.PathStatus, sources []services.PathStatus) (*services.Path, error) {
+	path, contains := ps.byHash[taskId]
+	if !contains {
+		return nil, pgx.ErrNoRows
+	}
+
+	from, err := services.ParsePathStatus(path.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, source := range sources {
+		if source == from {
+			return path, nil
+		}
+	}
+
+	return nil, &services.TransitionError{TaskId: taskId, From: from, To: status}
+}
+
+func (ps *PathService) UpdatePathStatusByTaskId(taskId string, status services.PathStatus) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	path, err := ps.transition(taskId, status, services.TransitionSources(status))
+	if err != nil {
+		return err
+	}
+
+	path.Status = status.String()
+
+	return nil
+}
+
+func (ps *PathService) ResetPathByTaskId(taskId string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	path, err := ps.transition(taskId, services.PathStatusInProgress, services.RestartSources())
+	if err != nil {
+		return err
+	}
+
+	path.Status = services.PathStatusInProgress.String()
+	path.Trace = ""
+	path.PagesExpanded = 0
+	path.SearchDepth = 0
+	path.Generation++
+
+	paths := ps.paths[:0]
+	for _, path := range ps.paths {
+		if path.OriginTaskHash == taskId {
+			delete(ps.byHash, path.TaskHash)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	ps.paths = paths
+
+	return nil
+}
+
+func (ps *PathService) RecordProgress(taskId string, depth int) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if path, contains := ps.byHash[taskId]; contains {
+		path.PagesExpanded++
+		if depth > path.SearchDepth {
+			path.SearchDepth = depth
+		}
+	}
+
+	return nil
+}
+
+func (ps *PathService) CreateFoundPath(dataSource, taskId, sourceUrl, destUrl, trace string) (*services.Path, error) {
+	return ps.createNewPath(dataSource, taskId, sourceUrl, destUrl, trace, services.PathStatusFound)
+}
+
+func (ps *PathService) GetPathsByTaskIds(taskIds []string) ([]*services.Path, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	paths := make([]*services.Path, 0, len(taskIds))
+
+	for _, taskId := range taskIds {
+		if path, contains := ps.byHash[taskId]; contains {
+			pathCopy := *path
+			paths = append(paths, &pathCopy)
+		}
+	}
+
+	return paths, nil
+}
+
+func (ps *PathService) BulkCreateFoundPaths(shapes []services.PathShapeForBulk) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if len(shapes) == 0 {
+		return nil
+	}
+
+	origin, contains := ps.byHash[shapes[0].OriginTaskId]
+	if !contains || origin.Status != services.PathStatusInProgress.String() || origin.Generation != shapes[0].Generation {
+		return services.ErrStaleSearch
+	}
+
+	for _, shape := range shapes {
+		if _, contains := ps.byHash[shape.TaskId]; contains {
+			continue
+		}
+
+		direction := shape.Direction
+		if direction == "" {
+			direction = services.TaskDirectionForward
+		}
+
+		path := &services.Path{
+			Id:             ps.nextId,
+			DataSource:     shape.DataSource,
+			SourceUrl:      shape.SourceUrl,
+			DestUrl:        shape.DestUrl,
+			TaskHash:       shape.TaskId,
+			Status:         services.PathStatusFound.String(),
+			Trace:          shape.Trace,
+			OriginTaskHash: shape.OriginTaskId,
+			ParentTaskHash: shape.ParentTaskId,
+			Direction:      direction,
+			Depth:          shape.Depth,
+			Generation:     shape.Generation,
+		}
+		ps.nextId++
+
+		ps.paths = append(ps.paths, path)
+		ps.byHash[path.TaskHash] = path
+	}
+
+	return nil
+}
+
+// parentChain walks parents of the given edge up to the root of its search.
+func (ps *PathService) parentChain(originTaskId, taskId string) []*services.Path {
+	chain := make([]*services.Path, 0)
+
+	path, contains := ps.byHash[taskId]
+	for contains && path.OriginTaskHash == originTaskId {
+		chain = append(chain, path)
+
+		parent, hasParent := ps.byHash[path.ParentTaskHash]
+		if !hasParent || parent.Depth >= path.Depth {
+			break
+		}
+		path = parent
+	}
+
+	return chain
+}
+
+// meetingEdges picks the shortest pair of forward and backward edges
+// discovering the same node within a search. The backward edge is nil when
+// the destination was reached by the forward edge alone.
+func (ps *PathService) meetingEdges(path *services.Path) (*services.Path, *services.Path) {
+	var forward, backward *services.Path
+
+	backwardByNode := make(map[string]*services.Path)
+	for _, b := range ps.paths {
+		if b.OriginTaskHash == path.TaskHash && b.Direction == services.TaskDirectionBackward {
+			backwardByNode[b.SourceUrl] = b
+		}
+	}
+
+	for _, f := range ps.paths {
+		if f.OriginTaskHash != path.TaskHash || f.Direction != services.TaskDirectionForward {
+			continue
+		}
+
+		b, contains := backwardByNode[f.DestUrl]
+		if !contains {
+			continue
+		}
+
+		if forward == nil || f.Depth+b.Depth < forward.Depth+backward.Depth {
+			forward, backward = f, b
+		}
+	}
+
+	if forward != nil {
+		return forward, backward
+	}
+
+	for _, f := range ps.paths {
+		if f.OriginTaskHash != path.TaskHash || f.Direction != services.TaskDirectionForward || f.DestUrl != path.DestUrl {
+			continue
+		}
+
+		if forward == nil || f.Depth < forward.Depth {
+			forward = f
+		}
+	}
+
+	return forward, nil
+}
+
+func (ps *PathService) BuildFullTraceAndUpdate(path *services.Path) (*services.Path, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	forward, backward := ps.meetingEdges(path)
+	if forward == nil {
+		return nil, pgx.ErrNoRows
+	}
+
+	backwardChain := []*services.Path{}
+	if backward != nil {
+		backwardChain = ps.parentChain(path.TaskHash, backward.TaskHash)
+	}
+
+	path.Trace = services.JoinTrace(ps.parentChain(path.TaskHash, forward.TaskHash), backwardChain)
+
+	for _, stored := range ps.paths {
+		if stored.Id == path.Id {
+			stored.Trace = path.Trace
+		}
+	}
+
+	return path, nil
+}
@@ -0,0 +1,257 @@
+package memservices
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/hash"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/services"
+)
+
+type taskRecord struct {
+	task           services.Task
+	seq            uint64
+	leaseOwner     string
+	leaseExpiresAt time.Time
+}
+
+// TaskService is an in-memory services.TaskService. It mirrors the behaviour
+// of dbservices.TaskService, including pgx.ErrNoRows for missing tasks, so it
+// can be used in place of Postgres in tests and in -storage=memory mode.
+type TaskService struct {
+	mu       sync.Mutex
+	tasks    map[string]*taskRecord
+	seq      uint64
+	requests map[string]int
+}
+
+func NewTaskService() *TaskService {
+	return &TaskService{
+		tasks:    make(map[string]*taskRecord),
+		requests: make(map[string]int),
+	}
+}
+
+func (ts *TaskService) CutUrlTitle(url string) string {
+	parts := strings.Split(url, "/")
+
+	return parts[len(parts)-1]
+}
+
+func (ts *TaskService) ShouldSkipTask(task *services.Task) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	count, contains := ts.requests[task.OriginTaskId]
+
+	return contains && count <= 0
+}
+
+func (ts *TaskService) GenerateId(sourceUrl, destUrl string) string {
+	return hash.GetMD5Hash(sourceUrl + destUrl)
+}
+
+func (ts *TaskService) GetTaskById(id string) (*services.Task, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	record, contains := ts.tasks[id]
+	if !contains {
+		return nil, pgx.ErrNoRows
+	}
+
+	task := record.task
+	task.RequestsCount = ts.requests[task.OriginTaskId]
+
+	return &task, nil
+}
+
+func (ts *TaskService) UpdateTaskRequestsCount(originTaskId string, n int) (int, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	count, contains := ts.requests[originTaskId]
+	if !contains {
+		return 0, pgx.ErrNoRows
+	}
+
+	count += n
+	if count < 0 {
+		count = 0
+	}
+	ts.requests[originTaskId] = count
+
+	return count, nil
+}
+
+func (ts *TaskService) CreateNewTask(newTask *services.Task) (*services.Task, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if record, contains := ts.tasks[newTask.Id]; contains {
+		task := record.task
+		return &task, nil
+	}
+
+	task := *newTask
+	if task.Direction == "" {
+		task.Direction = services.TaskDirectionForward
+	}
+
+	ts.seq++
+	ts.tasks[task.Id] = &taskRecord{
+		task: task,
+		seq:  ts.seq,
+	}
+
+	if task.Id == task.OriginTaskId {
+		ts.requests[task.OriginTaskId] += task.RequestsCount
+	}
+
+	task.RequestsCount = 0
+
+	return &task, nil
+}
+
+func (ts *TaskService) GetNEarliestTasks(dataSource string, n uint) ([]*services.Task, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	records := make([]*taskRecord, 0, len(ts.tasks))
+	for _, record := range ts.tasks {
+		if record.task.DataSource == dataSource {
+			records = append(records, record)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].seq < records[j].seq
+	})
+
+	if uint(len(records)) > n {
+		records = records[:n]
+	}
+
+	tasks := make([]*services.Task, 0, len(records))
+	for _, record := range records {
+		task := record.task
+		task.RequestsCount = 0
+		tasks = append(tasks, &task)
+	}
+
+	return tasks, nil
+}
+
+func (ts *TaskService) ClaimNEarliestTasks(owner, dataSource string, n uint, lease time.Duration) ([]*services.Task, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	now := time.Now()
+
+	records := make([]*taskRecord, 0)
+	for _, record := range ts.tasks {
+		if record.task.DataSource == dataSource && record.leaseExpiresAt.Before(now) {
+			records = append(records, record)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].seq < records[j].seq
+	})
+
+	if uint(len(records)) > n {
+		records = records[:n]
+	}
+
+	tasks := make([]*services.Task, 0, len(records))
+	for _, record := range records {
+		record.leaseOwner = owner
+		record.leaseExpiresAt = now.Add(lease)
+
+		task := record.task
+		task.RequestsCount = 0
+		tasks = append(tasks, &task)
+	}
+
+	return tasks, nil
+}
+
+func (ts *TaskService) ReleaseTasks(owner string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for _, record := range ts.tasks {
+		if record.leaseOwner == owner {
+			record.leaseOwner = ""
+			record.leaseExpiresAt = time.Time{}
+		}
+	}
+
+	return nil
+}
+
+func (ts *TaskService) RetryTask(id string, delay time.Duration) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if record, contains := ts.tasks[id]; contains {
+		record.task.Attempts++
+		record.leaseOwner = ""
+		record.leaseExpiresAt = time.Now().Add(delay)
+	}
+
+	return nil
+}
+
+func (ts *TaskService) PostponeTask(id string, delay time.Duration) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if record, contains := ts.tasks[id]; contains {
+		record.leaseOwner = ""
+		record.leaseExpiresAt = time.Now().Add(delay)
+	}
+
+	return nil
+}
+
+func (ts *TaskService) DeleteTaskByIds(id string, originId string, generation int) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if record, contains := ts.tasks[id]; contains && record.task.OriginTaskId == originId && record.task.Generation == generation {
+		delete(ts.tasks, id)
+	}
+
+	return nil
+}
+
+func (ts *TaskService) DeleteAllTasksWithOrigin(originId string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for id, record := range ts.tasks {
+		if record.task.OriginTaskId == originId {
+			delete(ts.tasks, id)
+		}
+	}
+
+	return nil
+}
+
+func (ts *TaskService) CountTasksWithOrigin(originId string) (int, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	count := 0
+	for _, record := range ts.tasks {
+		if record.task.OriginTaskId == originId {
+			count++
+		}
+	}
+
+	return count, nil
+}
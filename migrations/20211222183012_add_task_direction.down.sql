@@ -0,0 +1 @@
+alter table tasks_queue drop column direction;
\ No newline at end of file
@@ -0,0 +1,2 @@
+alter table tasks_queue
+add column direction varchar(16) not null default 'forward';
\ No newline at end of file
@@ -0,0 +1,2 @@
+alter table tasks_queue drop column depth,
+    drop column max_depth;
\ No newline at end of file
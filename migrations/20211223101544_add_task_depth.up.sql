@@ -0,0 +1,3 @@
+alter table tasks_queue
+add column depth int not null default 0,
+    add column max_depth int not null default 0;
\ No newline at end of file
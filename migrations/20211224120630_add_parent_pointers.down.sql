@@ -0,0 +1,6 @@
+drop index if exists paths_origin_task_hash_idx;
+alter table paths drop column origin_task_hash,
+    drop column parent_task_hash,
+    drop column direction,
+    drop column depth;
+alter table tasks_queue drop column parent_task_id;
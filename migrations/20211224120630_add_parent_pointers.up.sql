@@ -0,0 +1,8 @@
+alter table tasks_queue
+add column parent_task_id varchar(32) not null default '';
+alter table paths
+add column origin_task_hash varchar(32) not null default '',
+    add column parent_task_hash varchar(32) not null default '',
+    add column direction varchar(16) not null default 'forward',
+    add column depth int not null default 0;
+create index if not exists paths_origin_task_hash_idx on paths (origin_task_hash);
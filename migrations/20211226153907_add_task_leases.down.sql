@@ -0,0 +1,3 @@
+drop index if exists tasks_queue_created_at_idx;
+alter table tasks_queue drop column lease_owner,
+    drop column lease_expires_at;
\ No newline at end of file
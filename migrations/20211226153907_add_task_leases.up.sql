@@ -0,0 +1,4 @@
+alter table tasks_queue
+add column lease_owner varchar(64),
+    add column lease_expires_at timestamptz;
+create index if not exists tasks_queue_created_at_idx on tasks_queue (created_at);
\ No newline at end of file
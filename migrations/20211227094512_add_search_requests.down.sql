@@ -0,0 +1 @@
+drop table if exists search_requests;
\ No newline at end of file
@@ -0,0 +1,11 @@
+create table if not exists search_requests (
+    origin_task_id VARCHAR(32) primary key,
+    requests_count int not null default 0,
+    updated_at timestamp default current_timestamp
+);
+insert into search_requests (origin_task_id, requests_count)
+select origin_task_id, coalesce(max(requests_count), 1)
+from tasks_queue
+where id = origin_task_id
+group by origin_task_id
+on conflict do nothing;
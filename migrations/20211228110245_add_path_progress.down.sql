@@ -0,0 +1,2 @@
+alter table paths drop column pages_expanded,
+    drop column search_depth;
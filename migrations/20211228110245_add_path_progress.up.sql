@@ -0,0 +1,3 @@
+alter table paths
+add column pages_expanded int not null default 0,
+    add column search_depth int not null default 0;
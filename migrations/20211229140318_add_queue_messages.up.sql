@@ -0,0 +1,10 @@
+create table if not exists queue_messages (
+    queue varchar(64) not null,
+    id varchar(32) not null,
+    payload bytea not null,
+    deliveries int not null default 0,
+    visible_at timestamptz not null default now(),
+    created_at timestamptz not null default now(),
+    primary key (queue, id)
+);
+create index if not exists queue_messages_visible_at_idx on queue_messages (queue, visible_at);
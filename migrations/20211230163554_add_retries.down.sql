@@ -0,0 +1,2 @@
+drop table if exists dead_letters;
+alter table tasks_queue drop column attempts;
@@ -0,0 +1,10 @@
+alter table tasks_queue
+add column attempts int not null default 0;
+create table if not exists dead_letters (
+    id serial primary key,
+    task_id VARCHAR(32) not null,
+    origin_task_id VARCHAR(32) not null,
+    task jsonb not null,
+    error text not null default '',
+    created_at timestamp default current_timestamp
+);
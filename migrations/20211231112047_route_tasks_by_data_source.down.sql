@@ -0,0 +1,9 @@
+drop index if exists tasks_queue_data_source_created_at_idx;
+-- Rows created before data sources were introduced can't be told from rows of
+-- the wikipedia data source, both were claimed the same way back then.
+update tasks_queue
+set data_source = ''
+where data_source = 'wikipedia';
+update paths
+set data_source = ''
+where data_source = 'wikipedia';
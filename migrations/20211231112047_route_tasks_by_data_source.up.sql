@@ -0,0 +1,7 @@
+update tasks_queue
+set data_source = 'wikipedia'
+where data_source = '';
+update paths
+set data_source = 'wikipedia'
+where data_source = '';
+create index if not exists tasks_queue_data_source_created_at_idx on tasks_queue (data_source, created_at);
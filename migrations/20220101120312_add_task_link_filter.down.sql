@@ -0,0 +1 @@
+alter table tasks_queue drop column link_filter;
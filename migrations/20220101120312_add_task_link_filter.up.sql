@@ -0,0 +1,2 @@
+alter table tasks_queue
+add column link_filter jsonb not null default '{}';
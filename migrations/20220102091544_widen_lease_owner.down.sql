@@ -0,0 +1,3 @@
+-- Owners longer than the old limit are cut, the leases expire anyway.
+alter table tasks_queue
+alter column lease_owner type varchar(64) using left(lease_owner, 64);
@@ -0,0 +1,2 @@
+alter table tasks_queue
+alter column lease_owner type text;
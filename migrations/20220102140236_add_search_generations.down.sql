@@ -0,0 +1,2 @@
+alter table tasks_queue drop column generation;
+alter table paths drop column generation;
@@ -0,0 +1,4 @@
+alter table paths
+add column generation int not null default 0;
+alter table tasks_queue
+add column generation int not null default 0;
@@ -0,0 +1,3 @@
+-- Longer cursors are cut, their tasks restart the listing from a wrong page.
+alter table tasks_queue
+alter column cursor type varchar(255) using left(cursor, 255);
\ No newline at end of file
@@ -0,0 +1,2 @@
+alter table tasks_queue
+alter column cursor type text;
\ No newline at end of file
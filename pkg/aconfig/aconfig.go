@@ -13,3 +13,12 @@ func GetEnvOrInt(name string, defaultValue int) int {
 
 	return value
 }
+
+func GetEnvOrString(name string, defaultValue string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
@@ -6,4 +6,10 @@ type Handlers interface {
 	CreateTask(http.ResponseWriter, *http.Request)
 	DeleteTask(http.ResponseWriter, *http.Request)
 	GetPath(http.ResponseWriter, *http.Request)
+	GetPathEvents(http.ResponseWriter, *http.Request)
+
+	GetPlugins(http.ResponseWriter, *http.Request)
+
+	GetDeadLetters(http.ResponseWriter, *http.Request)
+	RequeueDeadLetter(http.ResponseWriter, *http.Request)
 }
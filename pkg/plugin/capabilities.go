@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"errors"
+	"strings"
+)
+
+// Capabilities describes the optional features of a plugin. The seeker picks
+// how to search a data source by them.
+type Capabilities struct {
+	// Backlinks means the plugin is a BacklinksPlugin, searches run from both
+	// ends then.
+	Backlinks bool `json:"backlinks"`
+	// Batch means the plugin is a BatchPlugin, queued tasks are expanded in
+	// batches then.
+	Batch bool `json:"batch"`
+	// BatchSize limits the number of requests in a batch, 0 means the queue
+	// size of the plugin.
+	BatchSize int `json:"batch_size,omitempty"`
+	// Normalize means the plugin is a NormalizerPlugin. Otherwise node ids
+	// are taken as users give them, only surrounding whitespace is dropped.
+	Normalize bool `json:"normalize"`
+	// Resolve means the plugin is a ResolverPlugin, so searches of entities
+	// that don't exist aren't started.
+	Resolve bool `json:"resolve"`
+	// Weights means connections returned by the plugin carry weights.
+	Weights bool `json:"weights"`
+}
+
+// CapabilitiesPlugin is implemented by plugins whose features depend on their
+// configuration, e.g. on the endpoints of an API. Capabilities advertised
+// without implementing the matching interface are ignored.
+type CapabilitiesPlugin interface {
+	Plugin
+	Capabilities() Capabilities
+}
+
+// GetCapabilities returns the capabilities p advertises. Plugins that aren't
+// a CapabilitiesPlugin advertise every interface they implement.
+func GetCapabilities(p Plugin) Capabilities {
+	_, backlinks := p.(BacklinksPlugin)
+	_, batch := p.(BatchPlugin)
+	_, normalize := p.(NormalizerPlugin)
+	_, resolve := p.(ResolverPlugin)
+
+	capabilitiesPlugin, ok := p.(CapabilitiesPlugin)
+	if !ok {
+		return Capabilities{
+			Backlinks: backlinks,
+			Batch:     batch,
+			Normalize: normalize,
+			Resolve:   resolve,
+		}
+	}
+
+	advertised := capabilitiesPlugin.Capabilities()
+
+	capabilities := Capabilities{
+		Backlinks: advertised.Backlinks && backlinks,
+		Batch:     advertised.Batch && batch,
+		Normalize: advertised.Normalize && normalize,
+		Resolve:   advertised.Resolve && resolve,
+		Weights:   advertised.Weights,
+	}
+	if capabilities.Batch {
+		capabilities.BatchSize = advertised.BatchSize
+	}
+
+	return capabilities
+}
+
+// AsBacklinksPlugin returns p as a BacklinksPlugin if it advertises backlinks.
+func AsBacklinksPlugin(p Plugin) (BacklinksPlugin, bool) {
+	if !GetCapabilities(p).Backlinks {
+		return nil, false
+	}
+
+	return p.(BacklinksPlugin), true
+}
+
+// AsBatchPlugin returns p as a BatchPlugin if it advertises batches.
+func AsBatchPlugin(p Plugin) (BatchPlugin, bool) {
+	if !GetCapabilities(p).Batch {
+		return nil, false
+	}
+
+	return p.(BatchPlugin), true
+}
+
+// AsResolverPlugin returns p as a ResolverPlugin if it advertises resolving.
+func AsResolverPlugin(p Plugin) (ResolverPlugin, bool) {
+	if !GetCapabilities(p).Resolve {
+		return nil, false
+	}
+
+	return p.(ResolverPlugin), true
+}
+
+// Normalize turns url into a node id of p. Plugins that don't advertise
+// normalization take node ids as they are, only surrounding whitespace is
+// dropped.
+func Normalize(p Plugin, url string) (string, error) {
+	if GetCapabilities(p).Normalize {
+		return p.(NormalizerPlugin).Normalize(url)
+	}
+
+	node := strings.TrimSpace(url)
+	if node == "" {
+		return "", Permanent(errors.New("empty node id"))
+	}
+
+	return node, nil
+}
@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrPermanent is matched by errors marked with Permanent.
+var ErrPermanent = errors.New("permanent error")
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func (e *permanentError) Is(target error) bool {
+	return target == ErrPermanent
+}
+
+// Permanent marks a request error that won't go away if the request is
+// retried, e.g. a malformed request.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err}
+}
+
+// IsRetryable reports whether a failed request is worth retrying. Errors are
+// retryable unless they are marked with Permanent.
+func IsRetryable(err error) bool {
+	return !errors.Is(err, ErrPermanent)
+}
+
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// RetryAfter marks a request error with the time the service asked to wait
+// before the next request, e.g. with the Retry-After header. The seeker backs
+// off the whole queue of the plugin for that long.
+func RetryAfter(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+
+	return &retryAfterError{err, after}
+}
+
+// GetRetryAfter returns the delay err was marked with by RetryAfter.
+func GetRetryAfter(err error) (time.Duration, bool) {
+	var retryAfterErr *retryAfterError
+	if errors.As(err, &retryAfterErr) {
+		return retryAfterErr.after, true
+	}
+
+	return 0, false
+}
+
+// ErrNotFound is matched by NotFoundError.
+var ErrNotFound = errors.New("not found")
+
+// NotFoundError lists nodes whose entities don't exist in the data source.
+type NotFoundError struct {
+	Nodes []string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("not found: %s", strings.Join(e.Nodes, ", "))
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
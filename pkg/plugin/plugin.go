@@ -6,20 +6,93 @@ type Connection struct {
 	SourceUrl string
 	DestUrl   string
 	Cursor    string
+	// Weight is the cost of following the connection, set by plugins
+	// advertising Capabilities.Weights. Lighter connections of a response
+	// are checked first.
+	Weight float64
 }
 
 type Response struct {
 	Connections []Connection
 }
 
+// LinkFilter narrows the connections returned for a request. Plugins ignore
+// the parts that make no sense for their data source.
+type LinkFilter struct {
+	// Namespaces limits connections to entities of the given namespaces, nil
+	// keeps the plugin defaults.
+	Namespaces []int
+	// KeepRedirects returns redirecting entities as they are instead of the
+	// entities they redirect to.
+	KeepRedirects bool
+	// SkipDisambiguation drops disambiguation entities.
+	SkipDisambiguation bool
+}
+
 type Request struct {
 	SourceUrl string
 	DestUrl   string
 	Cursor    string
+	Filter    LinkFilter
 }
 
+// Plugin lists the entities a given entity links to. Optional features are
+// provided by implementing the other interfaces of the package, see
+// Capabilities.
 type Plugin interface {
 	GetName() string
 	DoRequest(Request) (*Response, error)
 	GetQueueConfig() queue.Config
 }
+
+// NormalizerPlugin is implemented by plugins that know how users name
+// entities. Normalize turns a url or a name of an entity given by a user into
+// the node id the plugin uses for it in connections, so different ways of
+// naming the same entity lead to the same node. Entities the plugin can't
+// name are rejected with a Permanent error.
+type NormalizerPlugin interface {
+	Plugin
+	Normalize(url string) (string, error)
+}
+
+// BacklinksPlugin is implemented by plugins that can also list the entities
+// linking to a given one. The returned connections follow the same contract
+// as DoRequest: SourceUrl holds the linking entity and a connection with the
+// request SourceUrl and a non-empty Cursor continues the listing.
+type BacklinksPlugin interface {
+	Plugin
+	DoBacklinksRequest(Request) (*Response, error)
+}
+
+// ResolverPlugin is implemented by plugins that can check that entities exist
+// before a search starts. Resolve takes nodes returned by Normalize and
+// returns their canonical node ids in the same order, e.g. with redirects
+// followed. Nodes whose entities don't exist are reported with a
+// NotFoundError.
+type ResolverPlugin interface {
+	Plugin
+	Resolve(nodes []string) ([]string, error)
+}
+
+// BatchRequest is a request made as part of a batch.
+type BatchRequest struct {
+	Request
+	// Backward asks for the entities linking to SourceUrl, as
+	// DoBacklinksRequest does.
+	Backward bool
+}
+
+// BatchResult is the outcome of a request made as part of a batch.
+type BatchResult struct {
+	Response *Response
+	Err      error
+}
+
+// BatchPlugin is implemented by plugins that answer several requests at once
+// faster than one by one, e.g. with a single API call. DoBatchRequest returns
+// a result for every request in the same order, an error fails the whole
+// batch.
+type BatchPlugin interface {
+	Plugin
+	DoBatchRequest([]BatchRequest) ([]BatchResult, error)
+}
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+// ChannelQueue is a Queue kept in a buffered channel. Tasks it holds are lost
+// if the process dies.
+type ChannelQueue struct {
+	tasks           chan Task
+	stopConsumingCh chan struct{}
+	stopOnce        sync.Once
+
+	// leftovers are nacked tasks and tasks taken from the channel but not
+	// delivered. They are delivered before the channel.
+	leftoversMu sync.Mutex
+	leftovers   []Task
+}
+
+func NewChannelQueue(config Config) *ChannelQueue {
+	return &ChannelQueue{
+		tasks:           make(chan Task, config.QueueSize),
+		stopConsumingCh: make(chan struct{}),
+	}
+}
+
+func (q *ChannelQueue) Publish(ctx context.Context, task Task) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case q.tasks <- task:
+		return nil
+	}
+}
+
+func (q *ChannelQueue) StopConsuming() {
+	q.stopOnce.Do(func() {
+		close(q.stopConsumingCh)
+	})
+}
+
+func (q *ChannelQueue) Drain() []Task {
+	q.leftoversMu.Lock()
+	tasks := q.leftovers
+	q.leftovers = nil
+	q.leftoversMu.Unlock()
+
+	for {
+		select {
+		case task := <-q.tasks:
+			tasks = append(tasks, task)
+		default:
+			return tasks
+		}
+	}
+}
+
+func (q *ChannelQueue) keepLeftover(task Task) {
+	q.leftoversMu.Lock()
+	defer q.leftoversMu.Unlock()
+
+	q.leftovers = append(q.leftovers, task)
+}
+
+func (q *ChannelQueue) popLeftover() (Task, bool) {
+	q.leftoversMu.Lock()
+	defer q.leftoversMu.Unlock()
+
+	if len(q.leftovers) == 0 {
+		return nil, false
+	}
+
+	task := q.leftovers[0]
+	q.leftovers = q.leftovers[1:]
+
+	return task, true
+}
+
+func (q *ChannelQueue) newDelivery(task Task) *Delivery {
+	return NewDelivery(
+		task,
+		func() error { return nil },
+		func() error {
+			q.keepLeftover(task)
+			return nil
+		},
+	)
+}
+
+// next waits for a task to deliver.
+func (q *ChannelQueue) next(ctx context.Context) (Task, bool) {
+	if task, ok := q.popLeftover(); ok {
+		return task, true
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case <-q.stopConsumingCh:
+		return nil, false
+	case task := <-q.tasks:
+		return task, true
+	}
+}
+
+func (q *ChannelQueue) StartConsuming(ctx context.Context) <-chan *Delivery {
+	consumeChan := make(chan *Delivery)
+
+	go func() {
+		defer close(consumeChan)
+
+		for {
+			task, ok := q.next(ctx)
+			if !ok {
+				return
+			}
+
+			select {
+			case consumeChan <- q.newDelivery(task):
+			case <-ctx.Done():
+				q.keepLeftover(task)
+				return
+			case <-q.stopConsumingCh:
+				q.keepLeftover(task)
+				return
+			}
+		}
+	}()
+
+	return consumeChan
+}
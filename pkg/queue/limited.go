@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+// LimitedQueue delivers tasks of the wrapped queue within the limits of a
+// Limiter. A task takes a concurrency slot until it's acked or nacked. Slots
+// are taken only for tasks at hand, so an idle queue doesn't hold up other
+// queues sharing the limiter.
+type LimitedQueue struct {
+	Queue
+	limiter *Limiter
+
+	stopConsumingCh chan struct{}
+	stopOnce        sync.Once
+}
+
+func NewLimitedQueue(queue Queue, limiter *Limiter) *LimitedQueue {
+	return &LimitedQueue{
+		Queue:           queue,
+		limiter:         limiter,
+		stopConsumingCh: make(chan struct{}),
+	}
+}
+
+func (q *LimitedQueue) StopConsuming() {
+	q.stopOnce.Do(func() {
+		close(q.stopConsumingCh)
+	})
+	q.Queue.StopConsuming()
+}
+
+func (q *LimitedQueue) StartConsuming(ctx context.Context) <-chan *Delivery {
+	consumeChan := make(chan *Delivery)
+	deliveries := q.Queue.StartConsuming(ctx)
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		defer close(consumeChan)
+		defer cancel()
+
+		go func() {
+			select {
+			case <-q.stopConsumingCh:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		for {
+			delivery, ok := <-deliveries
+			if !ok {
+				return
+			}
+
+			permit, err := q.limiter.Acquire(ctx)
+			if err != nil {
+				delivery.Nack()
+				return
+			}
+
+			limited := NewDelivery(
+				delivery.Task,
+				func() error {
+					defer permit.Release()
+					return delivery.Ack()
+				},
+				func() error {
+					defer permit.Release()
+					return delivery.Nack()
+				},
+			)
+
+			select {
+			case consumeChan <- limited:
+			case <-ctx.Done():
+				limited.Nack()
+				return
+			}
+		}
+	}()
+
+	return consumeChan
+}
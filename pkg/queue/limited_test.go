@@ -0,0 +1,124 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, deliveries <-chan *Delivery, timeout time.Duration) *Delivery {
+	t.Helper()
+
+	select {
+	case delivery, ok := <-deliveries:
+		if !ok {
+			t.Fatal("deliveries are closed")
+		}
+		return delivery
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+func TestLimitedQueuesShareGroup(t *testing.T) {
+	config := Config{
+		Limits:     Limits{Concurrency: 1},
+		LimitGroup: t.Name(),
+		QueueSize:  10,
+	}
+
+	idle := NewLimitedQueue(NewChannelQueue(config), config.Limiter())
+	busy := NewLimitedQueue(NewChannelQueue(config), config.Limiter())
+	defer idle.StopConsuming()
+	defer busy.StopConsuming()
+
+	idleDeliveries := idle.StartConsuming(context.Background())
+	// The idle queue starts waiting first.
+	time.Sleep(20 * time.Millisecond)
+	busyDeliveries := busy.StartConsuming(context.Background())
+
+	ctx := context.Background()
+	for _, task := range []string{"a", "b"} {
+		if err := busy.Publish(ctx, Task(task)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The idle queue holds no slot, so the other one gets the only slot.
+	first := receive(t, busyDeliveries, time.Second)
+	if first == nil {
+		t.Fatal("queue sharing the group with an idle one got no delivery")
+	}
+
+	// Its second task waits until the first one releases the slot, and so
+	// does a task of the other queue.
+	if err := idle.Publish(ctx, Task("c")); err != nil {
+		t.Fatal(err)
+	}
+	if delivery := receive(t, busyDeliveries, 50*time.Millisecond); delivery != nil {
+		t.Fatalf("got %s beyond the concurrency of the group", delivery.Task)
+	}
+	if delivery := receive(t, idleDeliveries, 50*time.Millisecond); delivery != nil {
+		t.Fatalf("got %s beyond the concurrency of the group", delivery.Task)
+	}
+
+	if err := first.Ack(); err != nil {
+		t.Fatal(err)
+	}
+
+	var second *Delivery
+	select {
+	case second = <-busyDeliveries:
+	case second = <-idleDeliveries:
+	case <-time.After(time.Second):
+		t.Fatal("no delivery after the slot is released")
+	}
+	if err := second.Ack(); err != nil {
+		t.Fatal(err)
+	}
+
+	var third *Delivery
+	select {
+	case third = <-busyDeliveries:
+	case third = <-idleDeliveries:
+	case <-time.After(time.Second):
+		t.Fatal("no delivery after the slot is released")
+	}
+	third.Ack()
+
+	if string(second.Task) == string(third.Task) {
+		t.Errorf("%s is delivered twice", second.Task)
+	}
+}
+
+func TestLimitedQueueNacksWaitingDeliveryOnStop(t *testing.T) {
+	limiter := NewLimiter(Limits{Concurrency: 1})
+
+	holder := NewLimitedQueue(NewChannelQueue(Config{QueueSize: 1}), limiter)
+	defer holder.StopConsuming()
+	if err := holder.Publish(context.Background(), Task("held")); err != nil {
+		t.Fatal(err)
+	}
+	if receive(t, holder.StartConsuming(context.Background()), time.Second) == nil {
+		t.Fatal("no delivery")
+	}
+
+	waiting := NewLimitedQueue(NewChannelQueue(Config{QueueSize: 1}), limiter)
+	if err := waiting.Publish(context.Background(), Task("waiting")); err != nil {
+		t.Fatal(err)
+	}
+	deliveries := waiting.StartConsuming(context.Background())
+
+	// The task is taken from the channel and waits for the slot.
+	time.Sleep(50 * time.Millisecond)
+	waiting.StopConsuming()
+
+	if _, ok := <-deliveries; ok {
+		t.Fatal("got a delivery beyond the concurrency")
+	}
+
+	tasks := waiting.Drain()
+	if len(tasks) != 1 || string(tasks[0]) != "waiting" {
+		t.Fatalf("Drain = %q, want the task waiting for the slot", tasks)
+	}
+}
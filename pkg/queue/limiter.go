@@ -0,0 +1,186 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limits restrict how fast and how many tasks are delivered.
+type Limits struct {
+	// Rate is the average number of tasks delivered per second. Zero means
+	// no rate limit.
+	Rate float64
+	// Burst is the number of tasks that can be delivered at once after a
+	// quiet period. Defaults to 1.
+	Burst int
+	// Concurrency is the number of delivered tasks that can be processed at
+	// the same time, i.e. not acked or nacked yet. Zero means no limit.
+	Concurrency int
+}
+
+// Limiter enforces Limits with a token bucket refilled at Rate and holding up
+// to Burst tokens, and with a pool of Concurrency slots.
+type Limiter struct {
+	limits Limits
+	slots  chan struct{}
+
+	mu          sync.Mutex
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func NewLimiter(limits Limits) *Limiter {
+	if limits.Burst < 1 {
+		limits.Burst = 1
+	}
+
+	var slots chan struct{}
+	if limits.Concurrency > 0 {
+		slots = make(chan struct{}, limits.Concurrency)
+	}
+
+	return &Limiter{
+		limits: limits,
+		slots:  slots,
+		tokens: float64(limits.Burst),
+		last:   time.Now(),
+	}
+}
+
+var (
+	groupsMu sync.Mutex
+	groups   = make(map[string]*Limiter)
+)
+
+// GroupLimiter returns the limiter shared by everyone using the named group,
+// e.g. plugins calling the same host. The group is created with limits on
+// first use, limits passed later are ignored.
+func GroupLimiter(name string, limits Limits) *Limiter {
+	groupsMu.Lock()
+	defer groupsMu.Unlock()
+
+	if limiter, contains := groups[name]; contains {
+		return limiter
+	}
+
+	limiter := NewLimiter(limits)
+	groups[name] = limiter
+
+	return limiter
+}
+
+// Pause stops handing out permits for d, e.g. when the called service asks to
+// slow down. Overlapping pauses end with the latest one.
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Permit allows delivering a single task.
+type Permit struct {
+	limiter *Limiter
+	once    sync.Once
+}
+
+// Release frees the concurrency slot taken by the permit once its task is
+// processed.
+func (p *Permit) Release() {
+	p.once.Do(p.limiter.releaseSlot)
+}
+
+// Cancel gives back an unused permit, both its slot and its token.
+func (p *Permit) Cancel() {
+	p.once.Do(func() {
+		p.limiter.releaseSlot()
+		p.limiter.returnToken()
+	})
+}
+
+// Acquire waits for a free concurrency slot and a token.
+func (l *Limiter) Acquire(ctx context.Context) (*Permit, error) {
+	if l.slots != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case l.slots <- struct{}{}:
+		}
+	}
+
+	// A pause may start while waiting, so it's checked again after the wait.
+	for wait := l.reserveToken(); wait > 0; wait = l.pauseLeft() {
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			l.releaseSlot()
+			l.returnToken()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return &Permit{limiter: l}, nil
+}
+
+func (l *Limiter) pauseLeft() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return time.Until(l.pausedUntil)
+}
+
+// reserveToken takes a token, going into debt if there is none, and returns
+// the time until the debt is paid off and the limiter isn't paused.
+func (l *Limiter) reserveToken() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	pause := l.pausedUntil.Sub(now)
+
+	if l.limits.Rate <= 0 {
+		return pause
+	}
+
+	l.tokens += now.Sub(l.last).Seconds() * l.limits.Rate
+	if l.tokens > float64(l.limits.Burst) {
+		l.tokens = float64(l.limits.Burst)
+	}
+	l.last = now
+
+	l.tokens--
+
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.limits.Rate * float64(time.Second))
+	}
+	if pause > wait {
+		wait = pause
+	}
+
+	return wait
+}
+
+func (l *Limiter) returnToken() {
+	if l.limits.Rate <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens++
+}
+
+func (l *Limiter) releaseSlot() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
@@ -0,0 +1,191 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// tolerance absorbs scheduling delays of timing checks.
+const tolerance = 30 * time.Millisecond
+
+func TestLimiterTokenBucket(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		n      int
+		// min and max bound the time n permits take.
+		min, max time.Duration
+	}{
+		{"no rate", Limits{}, 10, 0, tolerance},
+		{"burst", Limits{Rate: 10, Burst: 3}, 3, 0, tolerance},
+		{"rate after burst", Limits{Rate: 20, Burst: 2}, 4, 100 * time.Millisecond, 100*time.Millisecond + tolerance},
+		{"burst defaults to 1", Limits{Rate: 20}, 3, 100 * time.Millisecond, 100*time.Millisecond + tolerance},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewLimiter(test.limits)
+
+			start := time.Now()
+			for i := 0; i < test.n; i++ {
+				permit, err := limiter.Acquire(context.Background())
+				if err != nil {
+					t.Fatalf("Acquire: %s", err)
+				}
+				permit.Release()
+			}
+			elapsed := time.Since(start)
+
+			if elapsed < test.min || elapsed > test.max {
+				t.Errorf("%d permits took %s, want between %s and %s", test.n, elapsed, test.min, test.max)
+			}
+		})
+	}
+}
+
+func TestLimiterCancelReturnsToken(t *testing.T) {
+	limiter := NewLimiter(Limits{Rate: 1, Burst: 1})
+
+	permit, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	permit.Cancel()
+
+	start := time.Now()
+	_, err = limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > tolerance {
+		t.Errorf("Acquire after Cancel took %s", elapsed)
+	}
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	limiter := NewLimiter(Limits{Concurrency: 2})
+
+	permits := make([]*Permit, 0, 2)
+	for i := 0; i < 2; i++ {
+		permit, err := limiter.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		permits = append(permits, permit)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx); err == nil {
+		t.Fatal("Acquire got a third slot of 2")
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		permit, err := limiter.Acquire(context.Background())
+		if err == nil {
+			permit.Release()
+		}
+		close(acquired)
+	}()
+
+	// Releasing twice frees a single slot.
+	permits[0].Release()
+	permits[0].Release()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Acquire didn't get the released slot")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	permit, err := limiter.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire: %s", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx); err == nil {
+		t.Fatal("double Release freed two slots")
+	}
+
+	permit.Release()
+	permits[1].Release()
+}
+
+func TestLimiterPause(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		pause  time.Duration
+	}{
+		{"no rate", Limits{}, 100 * time.Millisecond},
+		{"rate", Limits{Rate: 1000, Burst: 5}, 100 * time.Millisecond},
+		{"concurrency", Limits{Concurrency: 1}, 100 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewLimiter(test.limits)
+			limiter.Pause(test.pause)
+			// A shorter pause doesn't cut the longer one.
+			limiter.Pause(test.pause / 2)
+
+			start := time.Now()
+			permit, err := limiter.Acquire(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			permit.Release()
+
+			if elapsed := time.Since(start); elapsed < test.pause || elapsed > test.pause+tolerance {
+				t.Errorf("Acquire took %s, want %s", elapsed, test.pause)
+			}
+		})
+	}
+}
+
+func TestLimiterAcquireCancelled(t *testing.T) {
+	limiter := NewLimiter(Limits{Rate: 1, Burst: 1, Concurrency: 1})
+
+	permit, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	permit.Release()
+
+	// The bucket is empty, so this waits for a token and gives up.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Acquire = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The slot taken by the cancelled Acquire is free again.
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	permit, err = limiter.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire after a cancelled one: %s", err)
+	}
+	permit.Release()
+}
+
+func TestGroupLimiter(t *testing.T) {
+	first := GroupLimiter(t.Name(), Limits{Concurrency: 1})
+	second := GroupLimiter(t.Name(), Limits{Concurrency: 5})
+
+	if first != second {
+		t.Fatal("GroupLimiter returned different limiters for the same group")
+	}
+	if first.limits.Concurrency != 1 {
+		t.Errorf("Concurrency = %d, want the limits of the first use", first.limits.Concurrency)
+	}
+	if GroupLimiter(t.Name()+"-other", Limits{}) == first {
+		t.Error("GroupLimiter returned the same limiter for different groups")
+	}
+}
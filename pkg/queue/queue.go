@@ -1,57 +1,72 @@
 package queue
 
-import (
-	"context"
-	"time"
-)
+import "context"
 
 type Task []byte
 
-type Queue struct {
-	tasks           chan Task
-	config          Config
-	stopConsumingCh chan struct{}
-}
-
 type Config struct {
-	Delay     time.Duration
-	QueueSize uint
+	Limits
+	// LimitGroup makes queues of the same group share Limits, e.g. queues of
+	// plugins calling the same host. Limits of the first queue of the group
+	// apply.
+	LimitGroup string
+	QueueSize  uint
+	// Workers is the number of consumers processing tasks of the queue in
+	// parallel. They share Limits, so no more than Concurrency of them are
+	// busy at a time. Defaults to 1.
+	Workers uint
 }
 
-func New(config Config) Queue {
-	return Queue{
-		tasks:  make(chan Task, config.QueueSize),
-		config: config,
+// Limiter returns the limiter of the queue, shared by the whole group if
+// LimitGroup is set.
+func (c Config) Limiter() *Limiter {
+	if c.LimitGroup != "" {
+		return GroupLimiter(c.LimitGroup, c.Limits)
 	}
+
+	return NewLimiter(c.Limits)
+}
+
+// Queue passes tasks from producers to a consumer. Every delivered task has to
+// be acknowledged with Ack once it's processed or given back with Nack, so it
+// is delivered again.
+type Queue interface {
+	// Publish blocks until there is room for the task in the queue or ctx is
+	// done.
+	Publish(ctx context.Context, task Task) error
+	// StartConsuming delivers tasks until ctx is done or StopConsuming is
+	// called, then closes the channel. Backends deliver tasks as soon as they
+	// are taken from the channel, see LimitedQueue for limiting them.
+	StartConsuming(ctx context.Context) <-chan *Delivery
+	// StopConsuming stops delivering tasks.
+	StopConsuming()
+	// Drain removes and returns tasks held in memory that were published but
+	// not consumed. Durable backends keep such tasks and return nothing.
+	Drain() []Task
 }
 
-func (q *Queue) Publish(task Task) {
-	q.tasks <- task
+// Delivery is a task handed to the consumer.
+type Delivery struct {
+	Task Task
+
+	ack  func() error
+	nack func() error
+}
+
+func NewDelivery(task Task, ack, nack func() error) *Delivery {
+	return &Delivery{
+		Task: task,
+		ack:  ack,
+		nack: nack,
+	}
 }
 
-func (q *Queue) StopConsuming() {
-	q.stopConsumingCh <- struct{}{}
+// Ack removes the task from the queue for good.
+func (d *Delivery) Ack() error {
+	return d.ack()
 }
 
-func (q *Queue) StartConsuming(ctx context.Context) <-chan Task {
-	consumeChan := make(chan Task)
-
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-q.stopConsumingCh:
-				return
-			case task := <-q.tasks:
-				{
-					consumeChan <- task
-				}
-			}
-
-			time.Sleep(q.config.Delay)
-		}
-	}()
-
-	return consumeChan
+// Nack returns the task to the queue to be delivered again.
+func (d *Delivery) Nack() error {
+	return d.nack()
 }
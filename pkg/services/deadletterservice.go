@@ -0,0 +1,20 @@
+package services
+
+import "time"
+
+// DeadLetter is a task that failed for good, kept to be inspected and
+// requeued manually.
+type DeadLetter struct {
+	Id        uint      `json:"id"`
+	Task      *Task     `json:"task"`
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type DeadLetterService interface {
+	CreateDeadLetter(task *Task, reason string) (*DeadLetter, error)
+	// GetDeadLetters lists dead letters starting from the earliest.
+	GetDeadLetters(limit, offset uint) ([]*DeadLetter, error)
+	GetDeadLetterById(id uint) (*DeadLetter, error)
+	DeleteDeadLetterById(id uint) error
+}
@@ -1,5 +1,10 @@
 package services
 
+import (
+	"errors"
+	"strings"
+)
+
 type PathStatus uint
 
 const (
@@ -27,26 +32,85 @@ func (s PathStatus) String() string {
 }
 
 type Path struct {
-	Id        uint   `json:"id"`
-	SourceUrl string `json:"source_url"`
-	DestUrl   string `json:"dest_url"`
-	TaskHash  string
-	Status    string `json:"status"`
-	Trace     string `json:"trace"`
+	Id         uint   `json:"id"`
+	DataSource string `json:"data_source"`
+	SourceUrl  string `json:"source_url"`
+	DestUrl    string `json:"dest_url"`
+	TaskHash   string
+	Status     string `json:"status"`
+	Trace      string `json:"trace"`
+
+	// Progress of the search: number of pages expanded so far and the
+	// deepest level reached.
+	PagesExpanded int `json:"pages_expanded"`
+	SearchDepth   int `json:"search_depth"`
+
+	// Edges discovered by a search are stored as found paths pointing to the
+	// edge they were discovered from.
+	OriginTaskHash string        `json:"-"`
+	ParentTaskHash string        `json:"-"`
+	Direction      TaskDirection `json:"-"`
+	Depth          int           `json:"-"`
+	// Generation counts restarts of the search of an origin path, edges
+	// keep the generation of the search that discovered them.
+	Generation int `json:"-"`
 }
 
 type PathShapeForBulk struct {
-	TaskId    string
-	SourceUrl string
-	DestUrl   string
-	Trace     string
+	DataSource   string
+	TaskId       string
+	OriginTaskId string
+	ParentTaskId string
+	Direction    TaskDirection
+	Depth        int
+	SourceUrl    string
+	DestUrl      string
+	Trace        string
+	Generation   int
 }
 
+// ErrStaleSearch is returned for edges of a search that is over or was
+// restarted since they were discovered.
+var ErrStaleSearch = errors.New("search is over or was restarted")
+
 type PathService interface {
 	GetPathByTaskId(taskId string) (*Path, error)
 	CreateNewPath(task *Task) (*Path, error)
-	CreateFoundPath(taskId, sourceUrl, destUrl, trace string) (*Path, error) // make it batch
-	BulkCreateFoundPaths([]PathShapeForBulk) error                           // make it batch
+	CreateFoundPath(dataSource, taskId, sourceUrl, destUrl, trace string) (*Path, error) // make it batch
+	// BulkCreateFoundPaths stores edges discovered by the search of their
+	// origin, all of the same origin and generation. It returns
+	// ErrStaleSearch unless the search is in progress at that generation.
+	BulkCreateFoundPaths([]PathShapeForBulk) error
+	// UpdatePathStatusByTaskId moves a path to status. It returns
+	// *TransitionError if the current status can't go to status.
 	UpdatePathStatusByTaskId(taskId string, status PathStatus) error
+	// ResetPathByTaskId brings a not found or cancelled path back to in
+	// progress, starts the next generation of its search and drops edges
+	// discovered by the previous one.
+	ResetPathByTaskId(taskId string) error
+	GetPathsByTaskIds(taskIds []string) ([]*Path, error)
+	// RecordProgress counts one more page expanded by the search of taskId
+	// at the given depth.
+	RecordProgress(taskId string, depth int) error
+	// BuildFullTraceAndUpdate assembles the trace of a found path by walking
+	// parents of the edges discovered by its search.
 	BuildFullTraceAndUpdate(path *Path) (*Path, error)
 }
+
+// JoinTrace builds a comma separated trace from two parent chains of edges
+// meeting at the same node. forward goes from the meeting node up to the
+// source, backward goes from the meeting node down to the destination and may
+// be empty.
+func JoinTrace(forward, backward []*Path) string {
+	nodes := make([]string, 0, len(forward)+len(backward))
+
+	for i := len(forward) - 1; i >= 0; i-- {
+		nodes = append(nodes, forward[i].DestUrl)
+	}
+
+	for i := 1; i < len(backward); i++ {
+		nodes = append(nodes, backward[i].SourceUrl)
+	}
+
+	return strings.Join(nodes, ",")
+}
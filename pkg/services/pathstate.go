@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrIllegalTransition is matched by every *TransitionError.
+var ErrIllegalTransition = errors.New("illegal path status transition")
+
+// TransitionError is returned when a path can't go from its current status to
+// the requested one.
+type TransitionError struct {
+	TaskId string
+	From   PathStatus
+	To     PathStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("path %s: %s: %s -> %s", e.TaskId, ErrIllegalTransition, e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// pathStatusTransitions lists statuses a path can go to from every status.
+// Found is final, not found and cancelled searches can be restarted.
+var pathStatusTransitions = map[PathStatus][]PathStatus{
+	PathStatusNotStarted: {PathStatusInProgress, PathStatusCancelled},
+	PathStatusInProgress: {PathStatusFound, PathStatusNotFound, PathStatusCancelled},
+	PathStatusFound:      {},
+	PathStatusNotFound:   {PathStatusInProgress},
+	PathStatusCancelled:  {PathStatusInProgress},
+}
+
+var allPathStatuses = []PathStatus{
+	PathStatusNotStarted,
+	PathStatusInProgress,
+	PathStatusFound,
+	PathStatusNotFound,
+	PathStatusCancelled,
+}
+
+func ParsePathStatus(s string) (PathStatus, error) {
+	for _, status := range allPathStatuses {
+		if status.String() == s {
+			return status, nil
+		}
+	}
+
+	return PathStatusNotStarted, fmt.Errorf("unknown path status %q", s)
+}
+
+// CanTransitionTo reports whether a path with status s may go to status to.
+// Setting the current status again is allowed and changes nothing.
+func (s PathStatus) CanTransitionTo(to PathStatus) bool {
+	if s == to {
+		return true
+	}
+
+	for _, next := range pathStatusTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TransitionSources returns all statuses a path may go to status to from.
+func TransitionSources(to PathStatus) []PathStatus {
+	sources := make([]PathStatus, 0, len(allPathStatuses))
+
+	for _, status := range allPathStatuses {
+		if status.CanTransitionTo(to) {
+			sources = append(sources, status)
+		}
+	}
+
+	return sources
+}
+
+// RestartSources returns statuses of finished searches that may be started
+// again.
+func RestartSources() []PathStatus {
+	sources := make([]PathStatus, 0, len(allPathStatuses))
+
+	for _, status := range TransitionSources(PathStatusInProgress) {
+		if status != PathStatusInProgress {
+			sources = append(sources, status)
+		}
+	}
+
+	return sources
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to PathStatus
+		want     bool
+	}{
+		{PathStatusNotStarted, PathStatusInProgress, true},
+		{PathStatusNotStarted, PathStatusCancelled, true},
+		{PathStatusNotStarted, PathStatusFound, false},
+		{PathStatusInProgress, PathStatusInProgress, true},
+		{PathStatusInProgress, PathStatusFound, true},
+		{PathStatusInProgress, PathStatusNotFound, true},
+		{PathStatusInProgress, PathStatusCancelled, true},
+		{PathStatusInProgress, PathStatusNotStarted, false},
+		{PathStatusFound, PathStatusFound, true},
+		{PathStatusFound, PathStatusInProgress, false},
+		{PathStatusFound, PathStatusNotFound, false},
+		{PathStatusFound, PathStatusCancelled, false},
+		{PathStatusNotFound, PathStatusInProgress, true},
+		{PathStatusNotFound, PathStatusFound, false},
+		{PathStatusNotFound, PathStatusCancelled, false},
+		{PathStatusCancelled, PathStatusInProgress, true},
+		{PathStatusCancelled, PathStatusNotFound, false},
+		{PathStatusCancelled, PathStatusFound, false},
+	}
+
+	for _, test := range tests {
+		if got := test.from.CanTransitionTo(test.to); got != test.want {
+			t.Errorf("%s -> %s = %t, want %t", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestTransitionSources(t *testing.T) {
+	tests := []struct {
+		to   PathStatus
+		want []PathStatus
+	}{
+		{PathStatusNotStarted, []PathStatus{PathStatusNotStarted}},
+		{PathStatusInProgress, []PathStatus{PathStatusNotStarted, PathStatusInProgress, PathStatusNotFound, PathStatusCancelled}},
+		{PathStatusFound, []PathStatus{PathStatusInProgress, PathStatusFound}},
+		{PathStatusNotFound, []PathStatus{PathStatusInProgress, PathStatusNotFound}},
+		{PathStatusCancelled, []PathStatus{PathStatusNotStarted, PathStatusInProgress, PathStatusCancelled}},
+	}
+
+	for _, test := range tests {
+		if got := TransitionSources(test.to); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("TransitionSources(%s) = %v, want %v", test.to, got, test.want)
+		}
+	}
+}
+
+func TestRestartSources(t *testing.T) {
+	want := []PathStatus{PathStatusNotStarted, PathStatusNotFound, PathStatusCancelled}
+
+	if got := RestartSources(); !reflect.DeepEqual(got, want) {
+		t.Errorf("RestartSources() = %v, want %v", got, want)
+	}
+}
+
+func TestParsePathStatus(t *testing.T) {
+	for _, status := range allPathStatuses {
+		got, err := ParsePathStatus(status.String())
+		if err != nil || got != status {
+			t.Errorf("ParsePathStatus(%q) = %s, %v, want %s", status.String(), got, err, status)
+		}
+	}
+
+	_, err := ParsePathStatus("unknown")
+	if err == nil {
+		t.Error("ParsePathStatus(\"unknown\") succeeded")
+	}
+}
+
+func TestTransitionErrorIsIllegalTransition(t *testing.T) {
+	var err error = &TransitionError{TaskId: "task", From: PathStatusFound, To: PathStatusInProgress}
+
+	if !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("%v doesn't match ErrIllegalTransition", err)
+	}
+}
@@ -1,19 +1,61 @@
 package services
 
+import "time"
+
+type TaskDirection string
+
+const (
+	// TaskDirectionForward expands a node through its outgoing links.
+	TaskDirectionForward TaskDirection = "forward"
+	// TaskDirectionBackward expands a node through the links pointing to it.
+	TaskDirectionBackward TaskDirection = "backward"
+)
+
 type TaskBody struct {
 	SourceUrl string `json:"source_url"`
 	DestUrl   string `json:"dest_url"`
 	Cursor    string `json:"cursor"`
 }
 
+// LinkFilter narrows the links followed by a search. The zero value keeps the
+// defaults of the plugin.
+type LinkFilter struct {
+	// Namespaces limits links to pages of the given namespaces. Defaults to
+	// the namespaces configured for the plugin.
+	Namespaces []int `json:"namespaces,omitempty"`
+	// KeepRedirects follows links to redirect pages instead of resolving
+	// them to their targets.
+	KeepRedirects bool `json:"keep_redirects,omitempty"`
+	// SkipDisambiguation drops links to disambiguation pages.
+	SkipDisambiguation bool `json:"skip_disambiguation,omitempty"`
+}
+
+func (f LinkFilter) IsZero() bool {
+	return f.Namespaces == nil && !f.KeepRedirects && !f.SkipDisambiguation
+}
+
 type Task struct {
-	Id            string `json:"id"`
-	OriginTaskId  string `json:"origin_task_id"`
-	DataSource    string `json:"data_source"`
-	SourceUrl     string `json:"source_url"`
-	DestUrl       string `json:"dest_url"`
-	Cursor        string `json:"cursor"`
-	RequestsCount int    `json:"requests_count"`
+	Id            string        `json:"id"`
+	OriginTaskId  string        `json:"origin_task_id"`
+	ParentTaskId  string        `json:"parent_task_id"`
+	DataSource    string        `json:"data_source"`
+	SourceUrl     string        `json:"source_url"`
+	DestUrl       string        `json:"dest_url"`
+	Cursor        string        `json:"cursor"`
+	RequestsCount int           `json:"requests_count"`
+	Direction     TaskDirection `json:"direction"`
+	// Depth is the number of hops between the task node and the node its
+	// search direction started from.
+	Depth int `json:"depth"`
+	// MaxDepth limits the number of hops of the found path, 0 means unlimited.
+	MaxDepth int `json:"max_depth"`
+	// Attempts is the number of failed tries to process the task.
+	Attempts int `json:"attempts"`
+	// Filter is the link filter of the search, shared by all its tasks.
+	Filter LinkFilter `json:"filter"`
+	// Generation is the run of the search the task belongs to, see
+	// Path.Generation. Tasks of earlier runs are dropped.
+	Generation int `json:"generation"`
 }
 
 type TaskService interface {
@@ -22,9 +64,26 @@ type TaskService interface {
 
 	GenerateId(sourceUrl, destUrl string) string
 	GetTaskById(id string) (*Task, error)
-	CreateNewTask(id, originalTaskId, sourceUrl, destUrl, cursor string, requestsCount int) (*Task, error)
-	GetNEarliestTasks(uint) ([]*Task, error)
-	DeleteTaskByIds(id, originId string) error
+	CreateNewTask(task *Task) (*Task, error)
+	// GetNEarliestTasks returns up to n earliest tasks of the data source.
+	GetNEarliestTasks(dataSource string, n uint) ([]*Task, error)
+	// ClaimNEarliestTasks leases up to n earliest tasks of the data source,
+	// that aren't leased or whose lease has expired, to owner for the lease
+	// duration. Leased tasks stay in the queue until deleted, so they are
+	// redelivered if the owner dies before processing them.
+	ClaimNEarliestTasks(owner, dataSource string, n uint, lease time.Duration) ([]*Task, error)
+	// ReleaseTasks returns all tasks leased by owner back to the queue.
+	ReleaseTasks(owner string) error
+	// RetryTask counts a failed attempt of the task and returns it to the
+	// queue, where it can't be claimed until delay passes.
+	RetryTask(id string, delay time.Duration) error
+	// PostponeTask returns the task to the queue without counting an
+	// attempt, it can't be claimed until delay passes.
+	PostponeTask(id string, delay time.Duration) error
+	// DeleteTaskByIds deletes the task of the given generation of its search,
+	// leaving a task with the same id created by a later generation alone.
+	DeleteTaskByIds(id, originId string, generation int) error
 	DeleteAllTasksWithOrigin(string) error
+	CountTasksWithOrigin(originId string) (int, error)
 	UpdateTaskRequestsCount(string, int) (int, error)
 }
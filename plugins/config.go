@@ -0,0 +1,55 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/queue"
+)
+
+// maxNameLength is the size of the data_source columns.
+const maxNameLength = 32
+
+// validateName checks a plugin name can be stored as data_source of tasks.
+func validateName(name string) error {
+	if name == "" {
+		return errors.New("name is required")
+	}
+	if len(name) > maxNameLength {
+		return fmt.Errorf("name %s is longer than %d characters", name, maxNameLength)
+	}
+
+	return nil
+}
+
+// QueueConfig is the queue.Config of a plugin as it's given in config files.
+type QueueConfig struct {
+	// DelayMs is the average delay between requests in milliseconds, 0
+	// means no rate limit.
+	DelayMs     int  `json:"delay_ms"`
+	Burst       int  `json:"burst"`
+	Concurrency int  `json:"concurrency"`
+	QueueSize   uint `json:"queue_size"`
+	Workers     uint `json:"workers"`
+}
+
+// queueConfig builds the queue.Config of a plugin sharing rate limits with
+// everyone in limitGroup.
+func (c QueueConfig) queueConfig(limitGroup string) queue.Config {
+	var rate float64
+	if c.DelayMs > 0 {
+		rate = float64(time.Second) / float64(time.Millisecond*time.Duration(c.DelayMs))
+	}
+
+	return queue.Config{
+		Limits: queue.Limits{
+			Rate:        rate,
+			Burst:       c.Burst,
+			Concurrency: c.Concurrency,
+		},
+		LimitGroup: limitGroup,
+		QueueSize:  c.QueueSize,
+		Workers:    c.Workers,
+	}
+}
@@ -0,0 +1,170 @@
+package plugins
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	defaultDumpPageSize = 500
+	defaultDumpWorkers  = 4
+)
+
+// DumpConfig describes a link graph searched offline by a DumpPlugin. The
+// graph is read either from the page and pagelinks tables of a MediaWiki SQL
+// dump, see https://dumps.wikimedia.org, or from an edge list.
+type DumpConfig struct {
+	// Name is the name of the plugin and the data_source of its tasks.
+	Name string `json:"name"`
+	// Page is the path of the page table dump, e.g.
+	// enwiki-latest-page.sql.gz.
+	Page string `json:"page"`
+	// PageLinks is the path of the pagelinks table dump.
+	PageLinks string `json:"pagelinks"`
+	// LinkTarget is the path of the linktarget table dump. Dumps of
+	// MediaWiki 1.43 and later need it, as their pagelinks refer to link
+	// targets by id.
+	LinkTarget string `json:"linktarget"`
+	// Edges is the path of an edge list used instead of a SQL dump: a link
+	// per line given as source and destination titles separated by a tab.
+	Edges string `json:"edges"`
+	// Index is the path of the index built from the inputs. Defaults to the
+	// page dump or the edge list path with .idx appended.
+	Index string `json:"index"`
+	// Namespaces limits the graph of a SQL dump to pages of the given
+	// namespaces. Defaults to the main namespace, all namespaces are kept if
+	// it's set to an empty list. Pages outside of the main namespace are
+	// named with the namespace number, e.g. 14:Physics.
+	Namespaces []int `json:"namespaces"`
+	// CaseSensitive keeps the first letter of titles as it is instead of
+	// capitalising it.
+	CaseSensitive bool `json:"case_sensitive"`
+	// PageSize is the number of links returned for a request, the rest is
+	// returned for requests continuing it.
+	PageSize int         `json:"page_size"`
+	Queue    QueueConfig `json:"queue"`
+}
+
+func defaultDumpConfig() DumpConfig {
+	return DumpConfig{
+		Namespaces: []int{mainNamespace},
+		PageSize:   defaultDumpPageSize,
+		Queue: QueueConfig{
+			Burst:     1,
+			QueueSize: 25,
+			Workers:   defaultDumpWorkers,
+		},
+	}
+}
+
+// LoadDumpConfigs reads a JSON array of DumpConfig from path.
+func LoadDumpConfigs(path string) ([]DumpConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rawConfigs []json.RawMessage
+	err = json.NewDecoder(file).Decode(&rawConfigs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	configs := make([]DumpConfig, 0, len(rawConfigs))
+	for _, rawConfig := range rawConfigs {
+		config := defaultDumpConfig()
+
+		err = json.Unmarshal(rawConfig, &config)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+func (c DumpConfig) isSQLDump() bool {
+	return c.Edges == ""
+}
+
+func (c DumpConfig) validate() error {
+	err := validateName(c.Name)
+	if err != nil {
+		return fmt.Errorf("dump %w", err)
+	}
+
+	switch {
+	case c.Edges != "" && (c.Page != "" || c.PageLinks != "" || c.LinkTarget != ""):
+		return fmt.Errorf("dump %s: edges can't be used along with a SQL dump", c.Name)
+	case c.Edges == "" && (c.Page == "" || c.PageLinks == ""):
+		return fmt.Errorf("dump %s: either edges or both page and pagelinks are required", c.Name)
+	case c.PageSize <= 0:
+		return fmt.Errorf("dump %s: page_size has to be positive", c.Name)
+	}
+
+	return nil
+}
+
+// inputs lists the files the graph is read from.
+func (c DumpConfig) inputs() []string {
+	if !c.isSQLDump() {
+		return []string{c.Edges}
+	}
+
+	inputs := []string{c.Page, c.PageLinks}
+	if c.LinkTarget != "" {
+		inputs = append(inputs, c.LinkTarget)
+	}
+
+	return inputs
+}
+
+func (c DumpConfig) indexPath() string {
+	if c.Index != "" {
+		return c.Index
+	}
+
+	return c.inputs()[0] + ".idx"
+}
+
+// dumpInput identifies a version of an input file.
+type dumpInput struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+}
+
+// fingerprint identifies the inputs and the settings the index depends on,
+// so the index is rebuilt once any of them changes.
+func (c DumpConfig) fingerprint() ([16]byte, error) {
+	inputs := make([]dumpInput, 0, 3)
+	for _, path := range c.inputs() {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return [16]byte{}, err
+		}
+		if stat.IsDir() {
+			return [16]byte{}, errors.New(path + " is a directory")
+		}
+
+		inputs = append(inputs, dumpInput{path, stat.Size(), stat.ModTime().UnixNano()})
+	}
+
+	fingerprint, err := json.Marshal(struct {
+		Inputs        []dumpInput `json:"inputs"`
+		SQLDump       bool        `json:"sql_dump"`
+		Namespaces    []int       `json:"namespaces"`
+		CaseSensitive bool        `json:"case_sensitive"`
+	}{inputs, c.isSQLDump(), c.Namespaces, c.CaseSensitive})
+	if err != nil {
+		return [16]byte{}, err
+	}
+
+	return md5.Sum(fingerprint), nil
+}
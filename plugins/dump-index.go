@@ -0,0 +1,653 @@
+package plugins
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// linkIndexMagic starts link index files, its last byte is the version of
+// the format.
+const linkIndexMagic = "HSLINKS1"
+
+var errBadLinkIndex = errors.New("not a link index or it's corrupted")
+
+// linkIndexHeader starts a link index file. It's followed by sections:
+//
+//	title offsets     (Nodes+1) x uint64, offsets of titles in the titles section
+//	namespaces        Nodes x int32
+//	forward offsets   (Nodes+1) x uint64, offsets of links in forward links
+//	forward links     Edges x uint32, nodes every node links to
+//	backward offsets  (Nodes+1) x uint64, offsets of links in backward links
+//	backward links    Edges x uint32, nodes linking to every node
+//	titles            concatenated titles
+//
+// Nodes are numbered in the order of their titles, so a title is found with
+// a binary search, and links of a node are sorted. Numbers are little endian.
+type linkIndexHeader struct {
+	Magic [8]byte
+	// Fingerprint identifies the inputs and the settings the index was built
+	// from, it's rebuilt when they change.
+	Fingerprint [16]byte
+	Nodes       uint64
+	Edges       uint64
+}
+
+// linkIndex reads a link index file on demand, leaving caching to the OS.
+type linkIndex struct {
+	file   *os.File
+	header linkIndexHeader
+
+	titleOffsetsAt    int64
+	namespacesAt      int64
+	forwardOffsetsAt  int64
+	forwardLinksAt    int64
+	backwardOffsetsAt int64
+	backwardLinksAt   int64
+	titlesAt          int64
+}
+
+func openLinkIndex(path string) (*linkIndex, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &linkIndex{file: file}
+
+	err = binary.Read(io.NewSectionReader(file, 0, int64(binary.Size(index.header))), binary.LittleEndian, &index.header)
+	if err != nil || string(index.header.Magic[:]) != linkIndexMagic {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, errBadLinkIndex)
+	}
+
+	nodes, edges := int64(index.header.Nodes), int64(index.header.Edges)
+	index.titleOffsetsAt = int64(binary.Size(index.header))
+	index.namespacesAt = index.titleOffsetsAt + (nodes+1)*8
+	index.forwardOffsetsAt = index.namespacesAt + nodes*4
+	index.forwardLinksAt = index.forwardOffsetsAt + (nodes+1)*8
+	index.backwardOffsetsAt = index.forwardLinksAt + edges*4
+	index.backwardLinksAt = index.backwardOffsetsAt + (nodes+1)*8
+	index.titlesAt = index.backwardLinksAt + edges*4
+
+	// A file cut short by a crash while it was written is rebuilt.
+	titlesSize, err := index.readUint64(index.titleOffsetsAt + nodes*8)
+	stat, statErr := file.Stat()
+	if err != nil || statErr != nil || stat.Size() != index.titlesAt+int64(titlesSize) {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, errBadLinkIndex)
+	}
+
+	return index, nil
+}
+
+func (index *linkIndex) Close() error {
+	return index.file.Close()
+}
+
+func (index *linkIndex) readUint64(at int64) (uint64, error) {
+	var buf [8]byte
+
+	_, err := index.file.ReadAt(buf[:], at)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+// readRange reads a pair of adjacent offsets, i.e. where the entry of node
+// starts and ends.
+func (index *linkIndex) readRange(offsetsAt int64, node uint64) (uint64, uint64, error) {
+	var buf [16]byte
+
+	_, err := index.file.ReadAt(buf[:], offsetsAt+int64(node)*8)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return binary.LittleEndian.Uint64(buf[:8]), binary.LittleEndian.Uint64(buf[8:]), nil
+}
+
+func (index *linkIndex) title(node uint64) (string, error) {
+	start, end, err := index.readRange(index.titleOffsetsAt, node)
+	if err != nil {
+		return "", err
+	}
+
+	title := make([]byte, end-start)
+	_, err = index.file.ReadAt(title, index.titlesAt+int64(start))
+	if err != nil {
+		return "", err
+	}
+
+	return string(title), nil
+}
+
+func (index *linkIndex) namespace(node uint64) (int, error) {
+	var buf [4]byte
+
+	_, err := index.file.ReadAt(buf[:], index.namespacesAt+int64(node)*4)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(int32(binary.LittleEndian.Uint32(buf[:]))), nil
+}
+
+// find looks up the node of title.
+func (index *linkIndex) find(title string) (uint64, bool, error) {
+	var readErr error
+
+	node := sort.Search(int(index.header.Nodes), func(i int) bool {
+		if readErr != nil {
+			return true
+		}
+
+		nodeTitle, err := index.title(uint64(i))
+		if err != nil {
+			readErr = err
+			return true
+		}
+
+		return nodeTitle >= title
+	})
+	if readErr != nil {
+		return 0, false, readErr
+	}
+
+	if uint64(node) == index.header.Nodes {
+		return 0, false, nil
+	}
+
+	nodeTitle, err := index.title(uint64(node))
+	if err != nil {
+		return 0, false, err
+	}
+
+	return uint64(node), nodeTitle == title, nil
+}
+
+// links returns up to limit nodes node links to, or nodes linking to node if
+// backward is set, starting from offset, along with the number of all of
+// them.
+func (index *linkIndex) links(node uint64, backward bool, offset, limit uint64) ([]uint64, uint64, error) {
+	offsetsAt, linksAt := index.forwardOffsetsAt, index.forwardLinksAt
+	if backward {
+		offsetsAt, linksAt = index.backwardOffsetsAt, index.backwardLinksAt
+	}
+
+	start, end, err := index.readRange(offsetsAt, node)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	count := end - start
+	if offset >= count {
+		return nil, count, nil
+	}
+	if offset+limit > count {
+		limit = count - offset
+	}
+
+	buf := make([]byte, limit*4)
+	_, err = index.file.ReadAt(buf, linksAt+int64(start+offset)*4)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	nodes := make([]uint64, 0, limit)
+	for i := uint64(0); i < limit; i++ {
+		nodes = append(nodes, uint64(binary.LittleEndian.Uint32(buf[i*4:])))
+	}
+
+	return nodes, count, nil
+}
+
+// linkGraph collects a link graph in memory. Links are packed into a uint64
+// each to keep large graphs small.
+type linkGraph struct {
+	ids        map[string]uint32
+	titles     []string
+	namespaces []int32
+	links      []uint64
+}
+
+func newLinkGraph() *linkGraph {
+	return &linkGraph{
+		ids: make(map[string]uint32),
+	}
+}
+
+// node returns the node of title, adding it if it's new.
+func (g *linkGraph) node(title string, namespace int) uint32 {
+	if id, contains := g.ids[title]; contains {
+		return id
+	}
+
+	id := uint32(len(g.titles))
+	g.ids[title] = id
+	g.titles = append(g.titles, title)
+	g.namespaces = append(g.namespaces, int32(namespace))
+
+	return id
+}
+
+func (g *linkGraph) link(from, to uint32) {
+	g.links = append(g.links, uint64(from)<<32|uint64(to))
+}
+
+// sortLinks sorts packed links and drops duplicates.
+func sortLinks(links []uint64) []uint64 {
+	sort.Slice(links, func(i, j int) bool { return links[i] < links[j] })
+
+	unique := links[:0]
+	for i, link := range links {
+		if i == 0 || link != links[i-1] {
+			unique = append(unique, link)
+		}
+	}
+
+	return unique
+}
+
+// linkRunSize is the number of links sorted in memory at once, 64MB of them.
+const linkRunSize = 1 << 23
+
+// linkSorter sorts packed links too many to fit in memory. Links are sorted
+// in runs of runSize written to temporary files in dir, which are merged at
+// the end.
+type linkSorter struct {
+	dir     string
+	runSize int
+	buf     []uint64
+	runs    []*os.File
+}
+
+func newLinkSorter(dir string, runSize int) *linkSorter {
+	return &linkSorter{dir: dir, runSize: runSize}
+}
+
+func (s *linkSorter) add(link uint64) error {
+	s.buf = append(s.buf, link)
+	if len(s.buf) < s.runSize {
+		return nil
+	}
+
+	return s.spill()
+}
+
+// spill writes the links sorted so far as a run.
+func (s *linkSorter) spill() error {
+	file, err := os.CreateTemp(s.dir, "links-*.run")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, file)
+
+	w := bufio.NewWriterSize(file, 1<<20)
+
+	var buf [8]byte
+	for _, link := range sortLinks(s.buf) {
+		binary.LittleEndian.PutUint64(buf[:], link)
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	s.buf = s.buf[:0]
+
+	return w.Flush()
+}
+
+// linkRun is a run being merged, head is its smallest link not merged yet.
+type linkRun struct {
+	r    *bufio.Reader
+	head uint64
+}
+
+func (run *linkRun) next() error {
+	var buf [8]byte
+
+	_, err := io.ReadFull(run.r, buf[:])
+	if err != nil {
+		return err
+	}
+	run.head = binary.LittleEndian.Uint64(buf[:])
+
+	return nil
+}
+
+// linkRuns is a heap of runs ordered by their heads.
+type linkRuns []*linkRun
+
+func (h linkRuns) Len() int            { return len(h) }
+func (h linkRuns) Less(i, j int) bool  { return h[i].head < h[j].head }
+func (h linkRuns) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *linkRuns) Push(x interface{}) { *h = append(*h, x.(*linkRun)) }
+func (h *linkRuns) Pop() interface{} {
+	old := *h
+	run := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return run
+}
+
+// merge calls fn with all links added, sorted and without duplicates.
+func (s *linkSorter) merge(fn func(link uint64) error) error {
+	if len(s.runs) == 0 {
+		for _, link := range sortLinks(s.buf) {
+			if err := fn(link); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if len(s.buf) > 0 {
+		err := s.spill()
+		if err != nil {
+			return err
+		}
+	}
+
+	runs := make(linkRuns, 0, len(s.runs))
+	for _, file := range s.runs {
+		_, err := file.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+
+		run := &linkRun{r: bufio.NewReaderSize(file, 64*1024)}
+		err = run.next()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		runs = append(runs, run)
+	}
+	heap.Init(&runs)
+
+	merged := false
+	var last uint64
+	for len(runs) > 0 {
+		run := runs[0]
+		if !merged || run.head != last {
+			if err := fn(run.head); err != nil {
+				return err
+			}
+			merged, last = true, run.head
+		}
+
+		err := run.next()
+		switch {
+		case err == io.EOF:
+			heap.Pop(&runs)
+		case err != nil:
+			return err
+		default:
+			heap.Fix(&runs, 0)
+		}
+	}
+
+	return nil
+}
+
+// Close removes the runs.
+func (s *linkSorter) Close() error {
+	var firstErr error
+	for _, file := range s.runs {
+		file.Close()
+		if err := os.Remove(file.Name()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.runs = nil
+
+	return firstErr
+}
+
+// linkIndexBuilder builds a link index of a graph as large as a whole wiki.
+// Nodes are kept in memory, links are sorted on disk by linkSorter, so
+// memory grows with the number of pages but not with the number of links.
+// All nodes are added before the first link.
+type linkIndexBuilder struct {
+	dir     string
+	runSize int
+	nodes   *linkGraph
+	// order lists nodes in the order of their titles and rank numbers them
+	// in that order, both are set once the first link is added.
+	order   []uint32
+	rank    []uint32
+	forward *linkSorter
+}
+
+// newLinkIndexBuilder returns a builder keeping its temporary files in dir.
+func newLinkIndexBuilder(dir string) *linkIndexBuilder {
+	return &linkIndexBuilder{
+		dir:     dir,
+		runSize: linkRunSize,
+		nodes:   newLinkGraph(),
+	}
+}
+
+// node returns the node of title, adding it if it's new.
+func (b *linkIndexBuilder) node(title string, namespace int) uint32 {
+	return b.nodes.node(title, namespace)
+}
+
+// lookup returns the node of title if it was added.
+func (b *linkIndexBuilder) lookup(title string) (uint32, bool) {
+	node, contains := b.nodes.ids[title]
+	return node, contains
+}
+
+// rankNodes numbers nodes in the order of their titles.
+func (b *linkIndexBuilder) rankNodes() {
+	if b.rank != nil {
+		return
+	}
+
+	titles := b.nodes.titles
+
+	b.order = make([]uint32, len(titles))
+	for i := range b.order {
+		b.order[i] = uint32(i)
+	}
+	sort.Slice(b.order, func(i, j int) bool { return titles[b.order[i]] < titles[b.order[j]] })
+
+	b.rank = make([]uint32, len(titles))
+	for newId, oldId := range b.order {
+		b.rank[oldId] = uint32(newId)
+	}
+
+	b.forward = newLinkSorter(b.dir, b.runSize)
+}
+
+func (b *linkIndexBuilder) link(from, to uint32) error {
+	b.rankNodes()
+	return b.forward.add(uint64(b.rank[from])<<32 | uint64(b.rank[to]))
+}
+
+// Close removes temporary files of the builder.
+func (b *linkIndexBuilder) Close() error {
+	if b.forward == nil {
+		return nil
+	}
+
+	return b.forward.Close()
+}
+
+// stageLinks merges the links of sorter into a temporary file holding the
+// links section, counting links of every node by the upper half of packed
+// links into counts. fn is called with every link merged.
+func (b *linkIndexBuilder) stageLinks(sorter *linkSorter, counts []uint32, fn func(link uint64) error) (*os.File, uint64, error) {
+	file, err := os.CreateTemp(b.dir, "links-*.tmp")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	w := bufio.NewWriterSize(file, 1<<20)
+
+	var buf [4]byte
+	edges := uint64(0)
+	err = sorter.merge(func(link uint64) error {
+		counts[link>>32]++
+		edges++
+
+		binary.LittleEndian.PutUint32(buf[:], uint32(link))
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+
+		return fn(link)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, 0, err
+	}
+
+	return file, edges, nil
+}
+
+// writeLinks writes the offsets section from counts of links of every node
+// and copies the links section staged by stageLinks after it.
+func writeLinks(w io.Writer, counts []uint32, staged *os.File) error {
+	var buf [8]byte
+
+	offset := uint64(0)
+	for node := 0; node <= len(counts); node++ {
+		binary.LittleEndian.PutUint64(buf[:], offset)
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+		if node < len(counts) {
+			offset += uint64(counts[node])
+		}
+	}
+
+	_, err := io.Copy(w, staged)
+	return err
+}
+
+// removeStaged removes a file made by stageLinks.
+func removeStaged(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// write saves the graph as a link index at path. The file is written next to
+// path and renamed, so readers never see a partial index.
+func (b *linkIndexBuilder) write(path string, fingerprint [16]byte) error {
+	b.rankNodes()
+	defer b.Close()
+
+	nodes := len(b.nodes.titles)
+	counts := make([]uint32, nodes)
+
+	backward := newLinkSorter(b.dir, b.runSize)
+	defer backward.Close()
+
+	forwardLinks, edges, err := b.stageLinks(b.forward, counts, func(link uint64) error {
+		return backward.add(link<<32 | link>>32)
+	})
+	if err != nil {
+		return err
+	}
+	defer removeStaged(forwardLinks)
+
+	// Runs of forward links aren't needed anymore.
+	b.forward.Close()
+
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	defer file.Close()
+
+	w := bufio.NewWriterSize(file, 1<<20)
+
+	header := linkIndexHeader{
+		Fingerprint: fingerprint,
+		Nodes:       uint64(nodes),
+		Edges:       edges,
+	}
+	copy(header.Magic[:], linkIndexMagic)
+
+	err = binary.Write(w, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+
+	var buf [8]byte
+
+	titlesSize := uint64(0)
+	for i := 0; i <= nodes; i++ {
+		binary.LittleEndian.PutUint64(buf[:], titlesSize)
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+		if i < nodes {
+			titlesSize += uint64(len(b.nodes.titles[b.order[i]]))
+		}
+	}
+
+	for _, oldId := range b.order {
+		binary.LittleEndian.PutUint32(buf[:4], uint32(b.nodes.namespaces[oldId]))
+		if _, err := w.Write(buf[:4]); err != nil {
+			return err
+		}
+	}
+
+	err = writeLinks(w, counts, forwardLinks)
+	if err != nil {
+		return err
+	}
+
+	for i := range counts {
+		counts[i] = 0
+	}
+	backwardLinks, _, err := b.stageLinks(backward, counts, func(uint64) error { return nil })
+	if err != nil {
+		return err
+	}
+	defer removeStaged(backwardLinks)
+
+	err = writeLinks(w, counts, backwardLinks)
+	if err != nil {
+		return err
+	}
+
+	for _, oldId := range b.order {
+		if _, err := w.WriteString(b.nodes.titles[oldId]); err != nil {
+			return err
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,199 @@
+package plugins
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestIndex writes a link index of the graph given by adjacency lists.
+// Links are sorted in runs of two, so they're merged from several of them.
+func writeTestIndex(t *testing.T, links map[string][]string, namespaces map[string]int) *linkIndex {
+	t.Helper()
+
+	dir := t.TempDir()
+	graph := newLinkIndexBuilder(dir)
+	graph.runSize = 2
+
+	for source, targets := range links {
+		graph.node(source, namespaces[source])
+		for _, target := range targets {
+			graph.node(target, namespaces[target])
+		}
+	}
+	for source, targets := range links {
+		from, _ := graph.lookup(source)
+		for _, target := range targets {
+			to, _ := graph.lookup(target)
+			if err := graph.link(from, to); err != nil {
+				t.Fatalf("link: %s", err)
+			}
+		}
+	}
+
+	path := filepath.Join(dir, "links.idx")
+	err := graph.write(path, [16]byte{1})
+	if err != nil {
+		t.Fatalf("write: %s", err)
+	}
+
+	// Only the index is left.
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("files next to the index: %v, %v", entries, err)
+	}
+
+	index, err := openLinkIndex(path)
+	if err != nil {
+		t.Fatalf("openLinkIndex: %s", err)
+	}
+	t.Cleanup(func() { index.Close() })
+
+	return index
+}
+
+func TestLinkIndexFind(t *testing.T) {
+	index := writeTestIndex(t, map[string][]string{
+		"B": {"A", "C"},
+		"D": {},
+	}, map[string]int{"C": 14})
+
+	tests := []struct {
+		title     string
+		wantNode  uint64
+		wantFound bool
+	}{
+		{"A", 0, true},
+		{"B", 1, true},
+		{"C", 2, true},
+		{"D", 3, true},
+		{"", 0, false},
+		{"AA", 1, false},
+		{"E", 0, false},
+	}
+
+	for _, test := range tests {
+		node, found, err := index.find(test.title)
+		if err != nil {
+			t.Fatalf("find(%q): %s", test.title, err)
+		}
+		if found != test.wantFound || (found && node != test.wantNode) {
+			t.Errorf("find(%q) = %d, %t, want %d, %t", test.title, node, found, test.wantNode, test.wantFound)
+		}
+
+		if found {
+			title, err := index.title(node)
+			if err != nil || title != test.title {
+				t.Errorf("title(%d) = %q, %v, want %q", node, title, err, test.title)
+			}
+		}
+	}
+
+	node, _, _ := index.find("C")
+	if namespace, err := index.namespace(node); err != nil || namespace != 14 {
+		t.Errorf("namespace of C = %d, %v, want 14", namespace, err)
+	}
+}
+
+func TestLinkIndexLinks(t *testing.T) {
+	// Nodes are numbered by title: A 0, B 1, C 2, D 3. Duplicate links are
+	// dropped.
+	index := writeTestIndex(t, map[string][]string{
+		"A": {"C"},
+		"B": {"C", "A", "D", "C"},
+		"C": {"B"},
+		"D": {},
+	}, nil)
+
+	tests := []struct {
+		name          string
+		node          uint64
+		backward      bool
+		offset, limit uint64
+		want          []uint64
+		wantCount     uint64
+	}{
+		{"all", 1, false, 0, 10, []uint64{0, 2, 3}, 3},
+		{"first page", 1, false, 0, 2, []uint64{0, 2}, 3},
+		{"next page", 1, false, 2, 2, []uint64{3}, 3},
+		{"past the end", 1, false, 3, 2, nil, 3},
+		{"far past the end", 1, false, 100, 2, nil, 3},
+		{"no links", 3, false, 0, 10, nil, 0},
+		{"backlinks", 2, true, 0, 10, []uint64{0, 1}, 2},
+		{"backlinks page", 2, true, 1, 1, []uint64{1}, 2},
+		{"backlinks of a leaf", 3, true, 0, 10, []uint64{1}, 1},
+		{"last node", 3, true, 0, 1, []uint64{1}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nodes, count, err := index.links(test.node, test.backward, test.offset, test.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(nodes) == 0 {
+				nodes = nil
+			}
+
+			if !reflect.DeepEqual(nodes, test.want) || count != test.wantCount {
+				t.Errorf("links = %v of %d, want %v of %d", nodes, count, test.want, test.wantCount)
+			}
+		})
+	}
+}
+
+func TestLinkSorterMerge(t *testing.T) {
+	links := []uint64{5, 1<<32 | 2, 3, 5, 1 << 32, 0, 3, 7, 1<<32 | 2, 6, 0}
+	want := sortLinks(append([]uint64(nil), links...))
+
+	for _, runSize := range []int{1, 2, 3, len(links), len(links) + 1} {
+		dir := t.TempDir()
+		sorter := newLinkSorter(dir, runSize)
+		for _, link := range links {
+			if err := sorter.add(link); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var got []uint64
+		err := sorter.merge(func(link uint64) error {
+			got = append(got, link)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("runs of %d: merged %v, want %v", runSize, got, want)
+		}
+
+		if err := sorter.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("runs of %d: %d runs left after Close", runSize, len(entries))
+		}
+	}
+}
+
+func TestOpenLinkIndexRejectsTruncatedFile(t *testing.T) {
+	index := writeTestIndex(t, map[string][]string{"A": {"B"}}, nil)
+
+	content, err := os.ReadFile(index.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "truncated.idx")
+	err = os.WriteFile(path, content[:len(content)-1], 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = openLinkIndex(path)
+	if !errors.Is(err, errBadLinkIndex) {
+		t.Errorf("openLinkIndex = %v, want %v", err, errBadLinkIndex)
+	}
+}
@@ -0,0 +1,259 @@
+package plugins
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxEdgeLineLength is the longest line of an edge list.
+const maxEdgeLineLength = 1 << 20
+
+var errTruncatedValues = errors.New("truncated INSERT statement")
+
+// gzipFile closes both the gzip reader and the file under it.
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (f *gzipFile) Close() error {
+	f.Reader.Close()
+	return f.file.Close()
+}
+
+// openInput opens a dump file, decompressing it if its name ends with .gz as
+// dumps are published.
+func openInput(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &gzipFile{reader, file}, nil
+}
+
+// sqlRow is a row of a table of a SQL dump.
+type sqlRow struct {
+	columns map[string]int
+	values  []string
+}
+
+// get returns the value of the named column.
+func (r sqlRow) get(column string) (string, bool) {
+	i, contains := r.columns[column]
+	if !contains || i >= len(r.values) {
+		return "", false
+	}
+
+	return r.values[i], true
+}
+
+// readSQLDump calls fn with every row of table in a mysqldump file as
+// MediaWiki publishes them, e.g. enwiki-latest-pagelinks.sql.gz. Columns are
+// named by the CREATE TABLE statement of the dump, so dumps of different
+// MediaWiki versions can be read.
+func readSQLDump(path, table string, fn func(sqlRow) error) error {
+	input, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	createPrefix := fmt.Sprintf("CREATE TABLE `%s` (", table)
+	insertPrefix := fmt.Sprintf("INSERT INTO `%s` VALUES ", table)
+
+	row := sqlRow{columns: make(map[string]int)}
+	inCreate := false
+
+	reader := bufio.NewReaderSize(input, 1<<20)
+	for {
+		// INSERT statements of dumps are long lines holding many rows.
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		switch {
+		case strings.HasPrefix(line, createPrefix):
+			inCreate = true
+		case inCreate && strings.HasPrefix(line, ")"):
+			inCreate = false
+		case inCreate && strings.HasPrefix(strings.TrimSpace(line), "`"):
+			column := strings.TrimSpace(line)[1:]
+			if end := strings.IndexByte(column, '`'); end >= 0 {
+				row.columns[column[:end]] = len(row.columns)
+			}
+		case strings.HasPrefix(line, insertPrefix):
+			if len(row.columns) == 0 {
+				return fmt.Errorf("%s: INSERT INTO `%s` before its CREATE TABLE", path, table)
+			}
+
+			parseErr := parseInsertValues(line[len(insertPrefix):], func(values []string) error {
+				row.values = values
+				return fn(row)
+			})
+			if parseErr != nil {
+				return fmt.Errorf("%s: %w", path, parseErr)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if len(row.columns) == 0 {
+		return fmt.Errorf("%s: no table `%s` in the dump", path, table)
+	}
+
+	return nil
+}
+
+// parseInsertValues splits the values of an extended INSERT statement, e.g.
+// (1,0,'Title'),(2,0,'Other'); into rows. The slice passed to fn is reused.
+func parseInsertValues(values string, fn func([]string) error) error {
+	fields := make([]string, 0, 16)
+
+	for i := 0; i < len(values); {
+		switch values[i] {
+		case ',', ';', ' ', '\r', '\n':
+			i++
+			continue
+		case '(':
+		default:
+			return fmt.Errorf("unexpected %q in INSERT statement", values[i])
+		}
+
+		fields = fields[:0]
+		i++
+
+		for {
+			if i >= len(values) {
+				return errTruncatedValues
+			}
+
+			var value string
+			if values[i] == '\'' {
+				var err error
+				value, i, err = parseQuoted(values, i+1)
+				if err != nil {
+					return err
+				}
+			} else {
+				end := i
+				for end < len(values) && values[end] != ',' && values[end] != ')' {
+					end++
+				}
+				value, i = values[i:end], end
+			}
+			fields = append(fields, value)
+
+			if i >= len(values) {
+				return errTruncatedValues
+			}
+
+			i++
+			if values[i-1] == ')' {
+				break
+			}
+		}
+
+		err := fn(fields)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseQuoted reads a MySQL string literal starting after its opening quote
+// at i. It returns the unescaped value and the index after the closing quote.
+func parseQuoted(values string, i int) (string, int, error) {
+	var value strings.Builder
+
+	for i < len(values) {
+		c := values[i]
+
+		switch {
+		case c == '\\' && i+1 < len(values):
+			switch escaped := values[i+1]; escaped {
+			case '0':
+				value.WriteByte(0)
+			case 'n':
+				value.WriteByte('\n')
+			case 'r':
+				value.WriteByte('\r')
+			case 't':
+				value.WriteByte('\t')
+			case 'Z':
+				value.WriteByte(0x1a)
+			default:
+				value.WriteByte(escaped)
+			}
+			i += 2
+		case c == '\'' && i+1 < len(values) && values[i+1] == '\'':
+			value.WriteByte('\'')
+			i += 2
+		case c == '\'':
+			return value.String(), i + 1, nil
+		default:
+			value.WriteByte(c)
+			i++
+		}
+	}
+
+	return "", i, errTruncatedValues
+}
+
+// readEdgeList calls fn with every link of an edge list: a text file with a
+// link per line given as source and destination titles separated by a tab.
+// Empty lines and lines starting with # are skipped.
+func readEdgeList(path string, fn func(source, dest string) error) error {
+	input, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEdgeLineLength)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected source and destination separated by a tab", path, lineNumber)
+		}
+
+		err := fn(fields[0], fields[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
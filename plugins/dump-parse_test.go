@@ -0,0 +1,168 @@
+package plugins
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseInsertValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  string
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name:   "rows",
+			values: "(1,0,'Title'),(2,0,'Other');\n",
+			want:   [][]string{{"1", "0", "Title"}, {"2", "0", "Other"}},
+		},
+		{
+			name:   "empty and null",
+			values: "(1,NULL,''),(2,-1,'x');",
+			want:   [][]string{{"1", "NULL", ""}, {"2", "-1", "x"}},
+		},
+		{
+			name:   "separators in strings",
+			values: "(1,'a,b (c)'),(2,'))');",
+			want:   [][]string{{"1", "a,b (c)"}, {"2", "))"}},
+		},
+		{
+			name:   "escapes",
+			values: `(1,'It\'s'),(2,'a''b'),(3,'back\\slash'),(4,'new\nline\ttab'),(5,'\"quoted\"');`,
+			want: [][]string{
+				{"1", "It's"},
+				{"2", "a'b"},
+				{"3", `back\slash`},
+				{"4", "new\nline\ttab"},
+				{"5", `"quoted"`},
+			},
+		},
+		{
+			name:   "utf-8",
+			values: "(1,'Zürich'),(2,'東京');",
+			want:   [][]string{{"1", "Zürich"}, {"2", "東京"}},
+		},
+		{
+			name:    "truncated string",
+			values:  "(1,'abc",
+			want:    [][]string{},
+			wantErr: errTruncatedValues,
+		},
+		{
+			name:    "truncated row",
+			values:  "(1,0,'Title'),(2,0",
+			want:    [][]string{{"1", "0", "Title"}},
+			wantErr: errTruncatedValues,
+		},
+		{
+			name:   "garbage",
+			values: "(1,0),x",
+			want:   [][]string{{"1", "0"}},
+			// Any error, it isn't a sentinel.
+			wantErr: errors.New(""),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows := [][]string{}
+			err := parseInsertValues(test.values, func(fields []string) error {
+				rows = append(rows, append([]string{}, fields...))
+				return nil
+			})
+
+			switch {
+			case test.wantErr == nil && err != nil:
+				t.Fatalf("error = %v", err)
+			case test.wantErr != nil && err == nil:
+				t.Fatalf("no error, want %v", test.wantErr)
+			case test.wantErr == errTruncatedValues && err != errTruncatedValues:
+				t.Fatalf("error = %v, want %v", err, errTruncatedValues)
+			}
+
+			if !reflect.DeepEqual(rows, test.want) {
+				t.Errorf("rows = %q, want %q", rows, test.want)
+			}
+		})
+	}
+}
+
+func TestReadSQLDump(t *testing.T) {
+	dump := "-- MySQL dump\n" +
+		"CREATE TABLE `page` (\n" +
+		"  `page_id` int(8) unsigned NOT NULL AUTO_INCREMENT,\n" +
+		"  `page_namespace` int(11) NOT NULL DEFAULT 0,\n" +
+		"  `page_title` varbinary(255) NOT NULL DEFAULT '',\n" +
+		"  PRIMARY KEY (`page_id`)\n" +
+		") ENGINE=InnoDB;\n" +
+		"INSERT INTO `page` VALUES (1,0,'Albert_Einstein'),(2,14,'Physics');\n" +
+		"INSERT INTO `other` VALUES (3,0,'Ignored');\n" +
+		"INSERT INTO `page` VALUES (4,0,'Ulm');\n"
+
+	path := filepath.Join(t.TempDir(), "page.sql")
+	err := os.WriteFile(path, []byte(dump), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := [][]string{}
+	err = readSQLDump(path, "page", func(row sqlRow) error {
+		id, _ := row.get("page_id")
+		namespace, _ := row.get("page_namespace")
+		title, _ := row.get("page_title")
+		if _, contains := row.get("page_len"); contains {
+			t.Error("got a value of a column that isn't in the dump")
+		}
+
+		rows = append(rows, []string{id, namespace, title})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{{"1", "0", "Albert_Einstein"}, {"2", "14", "Physics"}, {"4", "0", "Ulm"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+
+	err = readSQLDump(path, "pagelinks", func(sqlRow) error { return nil })
+	if err == nil {
+		t.Error("reading a table missing from the dump succeeded")
+	}
+}
+
+func TestReadEdgeList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.tsv")
+	err := os.WriteFile(path, []byte("# comment\nA\tB\r\n\nB\tC\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edges := [][2]string{}
+	err = readEdgeList(path, func(source, dest string) error {
+		edges = append(edges, [2]string{source, dest})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][2]string{{"A", "B"}, {"B", "C"}}
+	if !reflect.DeepEqual(edges, want) {
+		t.Errorf("edges = %q, want %q", edges, want)
+	}
+
+	err = os.WriteFile(path, []byte("A\tB\tC\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = readEdgeList(path, func(string, string) error { return nil })
+	if err == nil {
+		t.Error("reading a line with three fields succeeded")
+	}
+}
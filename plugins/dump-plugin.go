@@ -0,0 +1,357 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/queue"
+)
+
+// DumpPlugin searches links of a MediaWiki dump or of an edge list offline.
+// The graph is read once into a compact index on disk and requests are
+// answered from the index, so searches need neither network nor much memory.
+// Building the index keeps pages in memory and sorts links on disk.
+type DumpPlugin struct {
+	name          string
+	index         *linkIndex
+	caseSensitive bool
+	pageSize      uint64
+	queueConfig   queue.Config
+}
+
+func NewDumpPlugin(config DumpConfig) (*DumpPlugin, error) {
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := loadLinkIndex(config)
+	if err != nil {
+		return nil, fmt.Errorf("dump %s: %w", config.Name, err)
+	}
+
+	return &DumpPlugin{
+		name:          config.Name,
+		index:         index,
+		caseSensitive: config.CaseSensitive,
+		pageSize:      uint64(config.PageSize),
+		queueConfig:   config.Queue.queueConfig(config.Name),
+	}, nil
+}
+
+// loadLinkIndex opens the index of the dump, building it first if it's
+// missing or was built from other inputs or settings.
+func loadLinkIndex(config DumpConfig) (*linkIndex, error) {
+	fingerprint, err := config.fingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	path := config.indexPath()
+
+	index, err := openLinkIndex(path)
+	if err == nil && index.header.Fingerprint == fingerprint {
+		return index, nil
+	}
+	if err == nil {
+		index.Close()
+	}
+
+	log.Printf("Building link index %s of dump %s...\n", path, config.Name)
+
+	// Links are sorted in temporary files next to the index.
+	graph := newLinkIndexBuilder(filepath.Dir(path))
+	defer graph.Close()
+
+	err = config.readGraph(graph)
+	if err != nil {
+		return nil, err
+	}
+
+	err = graph.write(path, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err = openLinkIndex(path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Built link index %s of dump %s: %d pages, %d links\n", path, config.Name, index.header.Nodes, index.header.Edges)
+
+	return index, nil
+}
+
+// nodeTitle names a page of a SQL dump. Dumps keep titles without their
+// namespace, so pages outside of the main namespace get its number.
+func (c DumpConfig) nodeTitle(namespace int, title string) string {
+	title = normalizeTitle(title, c.CaseSensitive)
+	if namespace == mainNamespace {
+		return title
+	}
+
+	return fmt.Sprintf("%d:%s", namespace, title)
+}
+
+func (c DumpConfig) readGraph(graph *linkIndexBuilder) error {
+	if !c.isSQLDump() {
+		return c.readEdgeListGraph(graph)
+	}
+
+	return c.readSQLDumpGraph(graph)
+}
+
+// readEdgeListGraph reads the edge list twice, as all nodes are added before
+// links.
+func (c DumpConfig) readEdgeListGraph(graph *linkIndexBuilder) error {
+	err := readEdgeList(c.Edges, func(source, dest string) error {
+		graph.node(normalizeTitle(source, c.CaseSensitive), mainNamespace)
+		graph.node(normalizeTitle(dest, c.CaseSensitive), mainNamespace)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return readEdgeList(c.Edges, func(source, dest string) error {
+		from, _ := graph.lookup(normalizeTitle(source, c.CaseSensitive))
+		to, _ := graph.lookup(normalizeTitle(dest, c.CaseSensitive))
+		if from == to {
+			return nil
+		}
+
+		return graph.link(from, to)
+	})
+}
+
+var errMissingColumn = errors.New("missing column")
+
+// readSQLDumpGraph reads pages of the configured namespaces and links between
+// them. Links to pages that don't exist are dropped.
+func (c DumpConfig) readSQLDumpGraph(graph *linkIndexBuilder) error {
+	namespaces := make(map[int]bool, len(c.Namespaces))
+	for _, namespace := range c.Namespaces {
+		namespaces[namespace] = true
+	}
+	allowed := func(namespace int) bool {
+		return len(namespaces) == 0 || namespaces[namespace]
+	}
+
+	pageNodes := make(map[uint64]uint32)
+
+	err := readSQLDump(c.Page, "page", func(row sqlRow) error {
+		id, namespace, title, err := readPageRow(row, "page_id", "page_namespace", "page_title")
+		if err != nil {
+			return err
+		}
+
+		if allowed(namespace) {
+			pageNodes[id] = graph.node(c.nodeTitle(namespace, title), namespace)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var linkTargets map[uint64]uint32
+	if c.LinkTarget != "" {
+		linkTargets = make(map[uint64]uint32)
+
+		err = readSQLDump(c.LinkTarget, "linktarget", func(row sqlRow) error {
+			id, namespace, title, err := readPageRow(row, "lt_id", "lt_namespace", "lt_title")
+			if err != nil {
+				return err
+			}
+
+			if node, contains := graph.lookup(c.nodeTitle(namespace, title)); contains && allowed(namespace) {
+				linkTargets[id] = node
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return readSQLDump(c.PageLinks, "pagelinks", func(row sqlRow) error {
+		fromStr, _ := row.get("pl_from")
+		fromId, err := strconv.ParseUint(fromStr, 10, 64)
+		if err != nil {
+			return fmt.Errorf("pagelinks: pl_from: %w", err)
+		}
+
+		from, contains := pageNodes[fromId]
+		if !contains {
+			return nil
+		}
+
+		var to uint32
+		if targetStr, hasTarget := row.get("pl_target_id"); hasTarget {
+			if linkTargets == nil {
+				return errors.New("pagelinks refer to link targets, the linktarget dump is required")
+			}
+
+			targetId, err := strconv.ParseUint(targetStr, 10, 64)
+			if err != nil {
+				return fmt.Errorf("pagelinks: pl_target_id: %w", err)
+			}
+
+			to, contains = linkTargets[targetId]
+		} else {
+			_, namespace, title, err := readPageRow(row, "pl_from", "pl_namespace", "pl_title")
+			if err != nil {
+				return err
+			}
+
+			to, contains = graph.lookup(c.nodeTitle(namespace, title))
+			contains = contains && allowed(namespace)
+		}
+
+		if !contains || from == to {
+			return nil
+		}
+
+		return graph.link(from, to)
+	})
+}
+
+// readPageRow reads the id, the namespace and the title of a page from the
+// named columns.
+func readPageRow(row sqlRow, idColumn, namespaceColumn, titleColumn string) (uint64, int, string, error) {
+	idStr, hasId := row.get(idColumn)
+	namespaceStr, hasNamespace := row.get(namespaceColumn)
+	title, hasTitle := row.get(titleColumn)
+	if !hasId || !hasNamespace || !hasTitle {
+		return 0, 0, "", fmt.Errorf("%w: expected %s, %s and %s", errMissingColumn, idColumn, namespaceColumn, titleColumn)
+	}
+
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("%s: %w", idColumn, err)
+	}
+
+	namespace, err := strconv.Atoi(namespaceStr)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("%s: %w", namespaceColumn, err)
+	}
+
+	return id, namespace, title, nil
+}
+
+func (p *DumpPlugin) GetName() string {
+	return p.name
+}
+
+// Normalize turns an article url or a title into a node title the way titles
+// of the dump are normalized.
+func (p *DumpPlugin) Normalize(rawUrl string) (string, error) {
+	title := normalizeTitle(titleFromUrl(rawUrl), p.caseSensitive)
+	if title == "" {
+		return "", plugin.Permanent(errors.New("empty title"))
+	}
+
+	return title, nil
+}
+
+// Resolve checks the titles are pages of the dump.
+func (p *DumpPlugin) Resolve(titles []string) ([]string, error) {
+	notFound := make([]string, 0)
+
+	for _, title := range titles {
+		_, contains, err := p.index.find(title)
+		if err != nil {
+			return nil, err
+		}
+		if !contains {
+			notFound = append(notFound, title)
+		}
+	}
+
+	if len(notFound) > 0 {
+		return nil, &plugin.NotFoundError{Nodes: notFound}
+	}
+
+	return titles, nil
+}
+
+// links answers a request from the index. Cursors are offsets into the links
+// of the page. Namespaces of the filter are applied, redirects and
+// disambiguation pages aren't known to the index.
+func (p *DumpPlugin) links(req plugin.Request, backward bool) (*plugin.Response, error) {
+	offset := uint64(0)
+	if req.Cursor != "" {
+		var err error
+		offset, err = strconv.ParseUint(req.Cursor, 10, 64)
+		if err != nil {
+			return nil, plugin.Permanent(fmt.Errorf("invalid cursor %s", req.Cursor))
+		}
+	}
+
+	node, contains, err := p.index.find(req.SourceUrl)
+	if err != nil {
+		return nil, err
+	}
+	if !contains {
+		return &plugin.Response{}, nil
+	}
+
+	nodes, count, err := p.index.links(node, backward, offset, p.pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces map[int]bool
+	if req.Filter.Namespaces != nil {
+		namespaces = make(map[int]bool, len(req.Filter.Namespaces))
+		for _, namespace := range req.Filter.Namespaces {
+			namespaces[namespace] = true
+		}
+	}
+
+	titles := make([]string, 0, len(nodes))
+	for _, linked := range nodes {
+		if namespaces != nil {
+			namespace, err := p.index.namespace(linked)
+			if err != nil {
+				return nil, err
+			}
+			if !namespaces[namespace] {
+				continue
+			}
+		}
+
+		title, err := p.index.title(linked)
+		if err != nil {
+			return nil, err
+		}
+
+		titles = append(titles, title)
+	}
+
+	cursor := ""
+	if next := offset + uint64(len(nodes)); next < count {
+		cursor = strconv.FormatUint(next, 10)
+	}
+
+	return buildResponse(req, titles, cursor), nil
+}
+
+func (p *DumpPlugin) DoRequest(req plugin.Request) (*plugin.Response, error) {
+	return p.links(req, false)
+}
+
+func (p *DumpPlugin) DoBacklinksRequest(req plugin.Request) (*plugin.Response, error) {
+	return p.links(req, true)
+}
+
+func (p *DumpPlugin) GetQueueConfig() queue.Config {
+	return p.queueConfig
+}
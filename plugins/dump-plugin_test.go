@@ -0,0 +1,60 @@
+package plugins
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+)
+
+func TestDumpPluginReadsEdgeList(t *testing.T) {
+	dir := t.TempDir()
+	edges := filepath.Join(dir, "links.tsv")
+	err := os.WriteFile(edges, []byte("a\tc\na\tb\nb\tc\nc\tc\na\tb\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := defaultDumpConfig()
+	config.Name = "fixture"
+	config.Edges = edges
+	p, err := NewDumpPlugin(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.index.Close()
+
+	// Only the edge list and its index are left.
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("%d files next to the index, want 2", len(entries))
+	}
+
+	tests := []struct {
+		source   string
+		backward bool
+		want     []string
+	}{
+		{"A", false, []string{"B", "C"}},
+		{"C", false, nil},
+		{"C", true, []string{"A", "B"}},
+		{"B", true, []string{"A"}},
+	}
+
+	for _, test := range tests {
+		req := plugin.Request{SourceUrl: test.source, DestUrl: "Z"}
+		resp, err := p.links(req, test.backward)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, connection := range resp.Connections {
+			got = append(got, connection.SourceUrl)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("links of %s, backward %t = %q, want %q", test.source, test.backward, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Formats of graph files.
+const (
+	graphFormatCSV     = "csv"
+	graphFormatTSV     = "tsv"
+	graphFormatJSON    = "json"
+	graphFormatGraphML = "graphml"
+)
+
+const (
+	defaultGraphFilePageSize = 100
+	defaultGraphFileWorkers  = 4
+)
+
+// GraphFileConfig describes a graph read from a local file and searched in
+// memory by a GraphFilePlugin.
+type GraphFileConfig struct {
+	// Name is the name of the plugin and the data_source of its tasks.
+	Name string `json:"name"`
+	// Path is the path of the graph file, .gz files are decompressed.
+	Path string `json:"path"`
+	// Format is csv, tsv, json or graphml. Defaults to the one the file
+	// extension names.
+	Format string `json:"format"`
+	// Undirected follows every edge both ways. GraphML files can declare it
+	// themselves with edgedefault and directed attributes.
+	Undirected bool `json:"undirected"`
+	// Header tells that the first row of a CSV or TSV file names its
+	// columns.
+	Header bool `json:"header"`
+	// SourceColumn and TargetColumn name the columns holding the ends of an
+	// edge in a CSV or TSV file with a header, case-insensitively. The first
+	// two columns are used otherwise.
+	SourceColumn string `json:"source_column"`
+	TargetColumn string `json:"target_column"`
+	// Label is the GraphML key, given by its id or attr.name, whose values
+	// name nodes instead of their ids.
+	Label string `json:"label"`
+	// Weight is the column of a CSV or TSV file with a header, or the
+	// GraphML key, holding weights of edges. Lighter links on a page are
+	// checked first.
+	Weight string `json:"weight"`
+	// PageSize is the number of links returned for a request, the rest is
+	// returned for requests continuing it.
+	PageSize int         `json:"page_size"`
+	Queue    QueueConfig `json:"queue"`
+}
+
+func defaultGraphFileConfig() GraphFileConfig {
+	return GraphFileConfig{
+		Header:       true,
+		SourceColumn: "source",
+		TargetColumn: "target",
+		PageSize:     defaultGraphFilePageSize,
+		Queue: QueueConfig{
+			Burst:     1,
+			QueueSize: 25,
+			Workers:   defaultGraphFileWorkers,
+		},
+	}
+}
+
+// LoadGraphFileConfigs reads a JSON array of GraphFileConfig from path.
+func LoadGraphFileConfigs(path string) ([]GraphFileConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rawConfigs []json.RawMessage
+	err = json.NewDecoder(file).Decode(&rawConfigs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	configs := make([]GraphFileConfig, 0, len(rawConfigs))
+	for _, rawConfig := range rawConfigs {
+		config := defaultGraphFileConfig()
+
+		err = json.Unmarshal(rawConfig, &config)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+// format returns Format or the format named by the extension of Path.
+func (c GraphFileConfig) format() string {
+	if c.Format != "" {
+		return c.Format
+	}
+
+	extension := filepath.Ext(strings.TrimSuffix(c.Path, ".gz"))
+	switch strings.ToLower(extension) {
+	case ".csv":
+		return graphFormatCSV
+	case ".tsv", ".tab":
+		return graphFormatTSV
+	case ".json":
+		return graphFormatJSON
+	case ".graphml", ".xml":
+		return graphFormatGraphML
+	}
+
+	return ""
+}
+
+func (c GraphFileConfig) validate() error {
+	err := validateName(c.Name)
+	if err != nil {
+		return fmt.Errorf("graph file %w", err)
+	}
+
+	if c.Path == "" {
+		return fmt.Errorf("graph file %s: path is required", c.Name)
+	}
+
+	switch c.format() {
+	case graphFormatCSV, graphFormatTSV, graphFormatJSON, graphFormatGraphML:
+	case "":
+		return fmt.Errorf("graph file %s: format of %q is unknown, set format", c.Name, c.Path)
+	default:
+		return fmt.Errorf("graph file %s: unknown format %s, expected csv, tsv, json or graphml", c.Name, c.Format)
+	}
+
+	if c.PageSize <= 0 {
+		return fmt.Errorf("graph file %s: page_size has to be positive", c.Name)
+	}
+
+	if c.Weight != "" && (c.format() == graphFormatJSON || (c.format() != graphFormatGraphML && !c.Header)) {
+		return fmt.Errorf("graph file %s: weight requires a CSV or TSV file with a header, or a GraphML file", c.Name)
+	}
+
+	return nil
+}
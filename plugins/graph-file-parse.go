@@ -0,0 +1,330 @@
+package plugins
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// addEdgeFunc adds an edge read from a graph file.
+type addEdgeFunc func(source, target string, weight float64, undirected bool)
+
+// readGraphFile reads the graph described by the config and the weights of
+// its links keyed by packed links, if the config names them. Edges given
+// more than once weigh as the lightest of them.
+func (c GraphFileConfig) readGraphFile() (*linkGraph, map[uint64]float64, error) {
+	input, err := openInput(c.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer input.Close()
+
+	graph := newLinkGraph()
+
+	var weights map[uint64]float64
+	if c.Weight != "" {
+		weights = make(map[uint64]float64)
+	}
+	link := func(from, to uint32, weight float64) {
+		graph.link(from, to)
+
+		if weights != nil {
+			packed := uint64(from)<<32 | uint64(to)
+			if current, contains := weights[packed]; !contains || weight < current {
+				weights[packed] = weight
+			}
+		}
+	}
+
+	addEdge := func(source, target string, weight float64, undirected bool) {
+		from := graph.node(source, mainNamespace)
+		to := graph.node(target, mainNamespace)
+		if from == to {
+			return
+		}
+
+		link(from, to, weight)
+		if undirected || c.Undirected {
+			link(to, from, weight)
+		}
+	}
+
+	switch c.format() {
+	case graphFormatCSV:
+		err = c.readCSVGraph(input, ',', addEdge)
+	case graphFormatTSV:
+		err = c.readCSVGraph(input, '\t', addEdge)
+	case graphFormatJSON:
+		err = c.readJSONGraph(input, graph, addEdge)
+	case graphFormatGraphML:
+		err = c.readGraphMLGraph(input, graph, addEdge)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", c.Path, err)
+	}
+
+	return graph, weights, nil
+}
+
+// readCSVGraph reads an edge list with an edge per row. Lines starting with #
+// are skipped.
+func (c GraphFileConfig) readCSVGraph(input io.Reader, delimiter rune, addEdge addEdgeFunc) error {
+	reader := csv.NewReader(input)
+	reader.Comma = delimiter
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+
+	sourceIndex, targetIndex, weightIndex := 0, 1, -1
+
+	if c.Header {
+		header, err := reader.Read()
+		if err != nil {
+			return err
+		}
+
+		sourceIndex, targetIndex = -1, -1
+		for i, column := range header {
+			column = strings.TrimSpace(column)
+			if strings.EqualFold(column, c.SourceColumn) {
+				sourceIndex = i
+			}
+			if strings.EqualFold(column, c.TargetColumn) {
+				targetIndex = i
+			}
+			if c.Weight != "" && strings.EqualFold(column, c.Weight) {
+				weightIndex = i
+			}
+		}
+		if sourceIndex < 0 || targetIndex < 0 {
+			return fmt.Errorf("header has to name %s and %s columns", c.SourceColumn, c.TargetColumn)
+		}
+		if c.Weight != "" && weightIndex < 0 {
+			return fmt.Errorf("header has to name %s column", c.Weight)
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+		columns := maxInt(maxInt(sourceIndex, targetIndex), weightIndex) + 1
+		if len(record) < columns {
+			return fmt.Errorf("line %d: expected at least %d columns", line, columns)
+		}
+
+		source := strings.TrimSpace(record[sourceIndex])
+		target := strings.TrimSpace(record[targetIndex])
+		if source == "" || target == "" {
+			return fmt.Errorf("line %d: empty node id", line)
+		}
+
+		weight := 0.0
+		if weightIndex >= 0 {
+			weight, err = parseWeight(record[weightIndex])
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+
+		addEdge(source, target, weight, false)
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+// parseWeight parses the weight of an edge, edges without one weigh 0.
+func parseWeight(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	weight, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid weight %s", value)
+	}
+
+	return weight, nil
+}
+
+// readJSONGraph reads an adjacency object: node ids mapped to lists of the
+// ids they link to, e.g. {"a": ["b", "c"], "b": []}. The object is read in
+// order, so links of a node are listed the same way after every restart.
+func (c GraphFileConfig) readJSONGraph(input io.Reader, graph *linkGraph, addEdge addEdgeFunc) error {
+	decoder := json.NewDecoder(input)
+	decoder.UseNumber()
+
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return errors.New("expected an object mapping node ids to lists of linked node ids")
+	}
+
+	for decoder.More() {
+		token, err = decoder.Token()
+		if err != nil {
+			return err
+		}
+		source := strings.TrimSpace(token.(string))
+		if source == "" {
+			return errors.New("empty node id")
+		}
+
+		var targets []interface{}
+		err = decoder.Decode(&targets)
+		if err != nil {
+			return fmt.Errorf("links of %s: %w", source, err)
+		}
+
+		graph.node(source, mainNamespace)
+		for _, value := range targets {
+			target, ok := scalarString(value)
+			target = strings.TrimSpace(target)
+			if !ok || target == "" {
+				return fmt.Errorf("links of %s: node ids have to be non-empty strings or numbers", source)
+			}
+
+			addEdge(source, target, 0, false)
+		}
+	}
+
+	return nil
+}
+
+type graphMLDocument struct {
+	Keys   []graphMLKey   `xml:"key"`
+	Graphs []graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	Id   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+}
+
+type graphMLGraph struct {
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	Id   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLEdge struct {
+	Source   string        `xml:"source,attr"`
+	Target   string        `xml:"target,attr"`
+	Directed string        `xml:"directed,attr"`
+	Data     []graphMLData `xml:"data"`
+}
+
+// findKey returns the id of the key of the given domain, node or edge,
+// matching name by id or attr.name.
+func (document graphMLDocument) findKey(name, domain string) (string, bool) {
+	for _, key := range document.Keys {
+		if (key.Id == name || key.Name == name) && (key.For == domain || key.For == "all" || key.For == "") {
+			return key.Id, true
+		}
+	}
+
+	return "", false
+}
+
+// readGraphMLGraph reads the top-level graphs of a GraphML document, see
+// http://graphml.graphdrawing.org. Nested graphs and hyperedges are ignored.
+func (c GraphFileConfig) readGraphMLGraph(input io.Reader, graph *linkGraph, addEdge addEdgeFunc) error {
+	var document graphMLDocument
+	err := xml.NewDecoder(input).Decode(&document)
+	if err != nil {
+		return err
+	}
+
+	labelKey := ""
+	if c.Label != "" {
+		var contains bool
+		labelKey, contains = document.findKey(c.Label, "node")
+		if !contains {
+			return fmt.Errorf("no node key %s", c.Label)
+		}
+	}
+
+	weightKey := ""
+	if c.Weight != "" {
+		var contains bool
+		weightKey, contains = document.findKey(c.Weight, "edge")
+		if !contains {
+			return fmt.Errorf("no edge key %s", c.Weight)
+		}
+	}
+
+	for _, g := range document.Graphs {
+		names := make(map[string]string, len(g.Nodes))
+		name := func(id string) string {
+			if name, contains := names[id]; contains {
+				return name
+			}
+
+			return id
+		}
+
+		for _, node := range g.Nodes {
+			names[node.Id] = node.Id
+			for _, data := range node.Data {
+				if label := strings.TrimSpace(data.Value); data.Key == labelKey && label != "" {
+					names[node.Id] = label
+				}
+			}
+
+			graph.node(name(node.Id), mainNamespace)
+		}
+
+		for _, edge := range g.Edges {
+			if edge.Source == "" || edge.Target == "" {
+				return errors.New("edge without source or target")
+			}
+
+			weight := 0.0
+			for _, data := range edge.Data {
+				if weightKey != "" && data.Key == weightKey {
+					weight, err = parseWeight(data.Value)
+					if err != nil {
+						return fmt.Errorf("edge %s-%s: %w", edge.Source, edge.Target, err)
+					}
+				}
+			}
+
+			undirected := edge.Directed == "false" || (edge.Directed == "" && g.EdgeDefault == "undirected")
+			addEdge(name(edge.Source), name(edge.Target), weight, undirected)
+		}
+	}
+
+	return nil
+}
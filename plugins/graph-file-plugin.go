@@ -0,0 +1,161 @@
+package plugins
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/queue"
+)
+
+// GraphFilePlugin searches a graph read from a CSV or TSV edge list, a JSON
+// adjacency object or a GraphML file. The graph is kept in memory, so it
+// suits test fixtures and exported datasets rather than whole wikis, see
+// DumpPlugin for those. Node ids are taken as they are.
+type GraphFilePlugin struct {
+	name      string
+	ids       map[string]uint32
+	nodes     []string
+	links     [][]uint32
+	backlinks [][]uint32
+	// linkWeights and backlinkWeights hold weights of links and backlinks,
+	// if the graph has them.
+	linkWeights     [][]float64
+	backlinkWeights [][]float64
+	pageSize        int
+	queueConfig     queue.Config
+}
+
+func NewGraphFilePlugin(config GraphFileConfig) (*GraphFilePlugin, error) {
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	graph, weights, err := config.readGraphFile()
+	if err != nil {
+		return nil, fmt.Errorf("graph file %s: %w", config.Name, err)
+	}
+
+	p := &GraphFilePlugin{
+		name:        config.Name,
+		ids:         graph.ids,
+		nodes:       graph.titles,
+		links:       make([][]uint32, len(graph.titles)),
+		backlinks:   make([][]uint32, len(graph.titles)),
+		pageSize:    config.PageSize,
+		queueConfig: config.Queue.queueConfig(config.Name),
+	}
+
+	if weights != nil {
+		p.linkWeights = make([][]float64, len(graph.titles))
+		p.backlinkWeights = make([][]float64, len(graph.titles))
+	}
+
+	// Links are sorted by source and then by target, so both directions list
+	// nodes in the order they first appear in the file.
+	links := sortLinks(graph.links)
+	for _, link := range links {
+		from, to := uint32(link>>32), uint32(link)
+		p.links[from] = append(p.links[from], to)
+		p.backlinks[to] = append(p.backlinks[to], from)
+
+		if weights != nil {
+			p.linkWeights[from] = append(p.linkWeights[from], weights[link])
+			p.backlinkWeights[to] = append(p.backlinkWeights[to], weights[link])
+		}
+	}
+
+	log.Printf("Loaded graph %s of %s: %d nodes, %d links\n", config.Path, config.Name, len(p.nodes), len(links))
+
+	return p, nil
+}
+
+func (p *GraphFilePlugin) GetName() string {
+	return p.name
+}
+
+func (p *GraphFilePlugin) Capabilities() plugin.Capabilities {
+	return plugin.Capabilities{
+		Backlinks: true,
+		Resolve:   true,
+		Weights:   p.linkWeights != nil,
+	}
+}
+
+// Resolve checks the nodes are in the graph.
+func (p *GraphFilePlugin) Resolve(nodes []string) ([]string, error) {
+	notFound := make([]string, 0)
+
+	for _, node := range nodes {
+		if _, contains := p.ids[node]; !contains {
+			notFound = append(notFound, node)
+		}
+	}
+
+	if len(notFound) > 0 {
+		return nil, &plugin.NotFoundError{Nodes: notFound}
+	}
+
+	return nodes, nil
+}
+
+// page answers a request from the adjacency lists. Cursors are offsets into
+// the links of the node, filters are ignored.
+func (p *GraphFilePlugin) page(req plugin.Request, adjacency [][]uint32, weights [][]float64) (*plugin.Response, error) {
+	offset := 0
+	if req.Cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(req.Cursor)
+		if err != nil || offset < 0 {
+			return nil, plugin.Permanent(fmt.Errorf("invalid cursor %s", req.Cursor))
+		}
+	}
+
+	node, contains := p.ids[req.SourceUrl]
+	if !contains {
+		return &plugin.Response{}, nil
+	}
+
+	linked := adjacency[node]
+	if offset > len(linked) {
+		offset = len(linked)
+	}
+
+	end := offset + p.pageSize
+	if end > len(linked) {
+		end = len(linked)
+	}
+
+	names := make([]string, 0, end-offset)
+	for _, id := range linked[offset:end] {
+		names = append(names, p.nodes[id])
+	}
+
+	cursor := ""
+	if end < len(linked) {
+		cursor = strconv.Itoa(end)
+	}
+
+	response := buildResponse(req, names, cursor)
+	if weights != nil {
+		for i := range names {
+			response.Connections[i].Weight = weights[node][offset+i]
+		}
+	}
+
+	return response, nil
+}
+
+func (p *GraphFilePlugin) DoRequest(req plugin.Request) (*plugin.Response, error) {
+	return p.page(req, p.links, p.linkWeights)
+}
+
+func (p *GraphFilePlugin) DoBacklinksRequest(req plugin.Request) (*plugin.Response, error) {
+	return p.page(req, p.backlinks, p.backlinkWeights)
+}
+
+func (p *GraphFilePlugin) GetQueueConfig() queue.Config {
+	return p.queueConfig
+}
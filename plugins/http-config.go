@@ -0,0 +1,179 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	nodePlaceholder   = "{node}"
+	cursorPlaceholder = "{cursor}"
+
+	defaultHTTPTimeoutMs = 30000
+)
+
+// HTTPEndpointConfig describes a request listing nodes linked to a node.
+type HTTPEndpointConfig struct {
+	// Url is the url template of the request, e.g.
+	// https://catalog.internal/api/services/{node}/dependencies. {node} and
+	// {cursor} are replaced with the node and the cursor of the request.
+	Url string `json:"url"`
+	// Query holds query parameters added to the url, values are templates as
+	// well. Parameters referring to {cursor} are left out of the first
+	// request of a node.
+	Query map[string]string `json:"query"`
+	// Nodes is a JSONPath expression selecting ids of the linked nodes in the
+	// response, e.g. $.items[*].id. Only the subset described by jsonPath is
+	// supported.
+	Nodes string `json:"nodes"`
+	// Cursor is a JSONPath expression selecting the cursor of the next page
+	// of the response, e.g. $.next_page_token. Responses aren't paged if
+	// it's empty.
+	Cursor string `json:"cursor"`
+}
+
+// HTTPPluginConfig describes a plugin searching links of a REST API
+// returning JSON.
+type HTTPPluginConfig struct {
+	// Name is the name of the plugin and the data_source of its tasks.
+	Name string `json:"name"`
+	// Links lists nodes a node links to.
+	Links HTTPEndpointConfig `json:"links"`
+	// Backlinks lists nodes linking to a node. Searches run from both ends
+	// if it's set.
+	Backlinks *HTTPEndpointConfig `json:"backlinks"`
+	// Headers are sent with every request. $VAR and ${VAR} in values are
+	// replaced with the env variable VAR, so secrets can be kept out of the
+	// file.
+	Headers   map[string]string `json:"headers"`
+	TimeoutMs int               `json:"timeout_ms"`
+	Queue     QueueConfig       `json:"queue"`
+}
+
+func defaultHTTPPluginConfig() HTTPPluginConfig {
+	return HTTPPluginConfig{
+		TimeoutMs: defaultHTTPTimeoutMs,
+		Queue: QueueConfig{
+			DelayMs:     500,
+			Burst:       1,
+			Concurrency: 1,
+			QueueSize:   25,
+			Workers:     1,
+		},
+	}
+}
+
+// LoadHTTPPluginConfigs reads a JSON array of HTTPPluginConfig from path and
+// validates them, so mistakes such as unsupported JSONPath expressions are
+// reported before any plugin starts. YAML isn't supported.
+func LoadHTTPPluginConfigs(path string) ([]HTTPPluginConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rawConfigs []json.RawMessage
+	err = json.NewDecoder(file).Decode(&rawConfigs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	configs := make([]HTTPPluginConfig, 0, len(rawConfigs))
+	for _, rawConfig := range rawConfigs {
+		config := defaultHTTPPluginConfig()
+
+		err = json.Unmarshal(rawConfig, &config)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+
+		err = config.validate()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+func (c HTTPPluginConfig) validate() error {
+	err := validateName(c.Name)
+	if err != nil {
+		return fmt.Errorf("http plugin %w", err)
+	}
+
+	if c.TimeoutMs <= 0 {
+		return fmt.Errorf("http plugin %s: timeout_ms has to be positive", c.Name)
+	}
+
+	err = c.Links.validate()
+	if err != nil {
+		return fmt.Errorf("http plugin %s: links: %w", c.Name, err)
+	}
+
+	if c.Backlinks != nil {
+		err = c.Backlinks.validate()
+		if err != nil {
+			return fmt.Errorf("http plugin %s: backlinks: %w", c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c HTTPEndpointConfig) validate() error {
+	if !strings.Contains(c.Url, nodePlaceholder) && !queryContains(c.Query, nodePlaceholder) {
+		return fmt.Errorf("url or query has to refer to %s", nodePlaceholder)
+	}
+
+	// Placeholders are replaced with escaped values, so they can't make an
+	// absolute url relative.
+	templateUrl, err := url.Parse(c.Url)
+	if err != nil {
+		return err
+	}
+	if templateUrl.Host == "" || (templateUrl.Scheme != "http" && templateUrl.Scheme != "https") {
+		return fmt.Errorf("url %q has to be an absolute http(s) url", c.Url)
+	}
+
+	if c.Nodes == "" {
+		return fmt.Errorf("nodes expression is required")
+	}
+	if _, err := compileJSONPath(c.Nodes); err != nil {
+		return fmt.Errorf("nodes: %w", err)
+	}
+
+	if c.Cursor != "" {
+		if _, err := compileJSONPath(c.Cursor); err != nil {
+			return fmt.Errorf("cursor: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func queryContains(query map[string]string, placeholder string) bool {
+	for _, value := range query {
+		if strings.Contains(value, placeholder) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// headers returns Headers with env variables expanded.
+func (c HTTPPluginConfig) headers() map[string]string {
+	headers := make(map[string]string, len(c.Headers))
+	for name, value := range c.Headers {
+		headers[name] = os.Expand(value, os.Getenv)
+	}
+
+	return headers
+}
@@ -0,0 +1,61 @@
+package plugins
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadHTTPPluginConfigs(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// wantErr is part of the error, the configs are loaded if it's empty.
+		wantErr string
+	}{
+		{
+			"valid",
+			`[{"name": "org", "links": {"url": "https://people.internal/{node}", "nodes": "$.items[*].id", "cursor": "$['next page']"}}]`,
+			"",
+		},
+		{
+			"recursive descent",
+			`[{"name": "org", "links": {"url": "https://people.internal/{node}", "nodes": "$..id"}}]`,
+			"http plugin org: links: nodes: jsonpath $..id: recursive descent",
+		},
+		{
+			"filter in backlinks cursor",
+			`[{"name": "org", "links": {"url": "https://people.internal/{node}", "nodes": "$.id"},
+			"backlinks": {"url": "https://people.internal/{node}", "nodes": "$.id", "cursor": "$.pages[?(@.next)]"}}]`,
+			"http plugin org: backlinks: cursor: jsonpath $.pages[?(@.next)]: unsupported selector",
+		},
+		{
+			"YAML",
+			"- name: org\n",
+			"parsing",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "http-plugins.json")
+			err := os.WriteFile(path, []byte(test.content), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			configs, err := LoadHTTPPluginConfigs(path)
+			if test.wantErr == "" {
+				if err != nil || len(configs) != 1 {
+					t.Fatalf("LoadHTTPPluginConfigs = %v, %v", configs, err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("error = %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
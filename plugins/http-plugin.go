@@ -0,0 +1,235 @@
+package plugins
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/queue"
+)
+
+// maxHTTPResponseSize limits the size of a response read by an HTTPPlugin.
+const maxHTTPResponseSize = 32 << 20
+
+// httpEndpoint is a compiled HTTPEndpointConfig.
+type httpEndpoint struct {
+	url    string
+	query  map[string]string
+	nodes  jsonPath
+	cursor jsonPath
+}
+
+func newHTTPEndpoint(config HTTPEndpointConfig) (*httpEndpoint, error) {
+	nodes, err := compileJSONPath(config.Nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor jsonPath
+	if config.Cursor != "" {
+		cursor, err = compileJSONPath(config.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &httpEndpoint{
+		url:    config.Url,
+		query:  config.Query,
+		nodes:  nodes,
+		cursor: cursor,
+	}, nil
+}
+
+// requestUrl fills the templates of the endpoint in with the node and the
+// cursor of req.
+func (e *httpEndpoint) requestUrl(req plugin.Request) (string, error) {
+	pathReplacer := strings.NewReplacer(
+		nodePlaceholder, url.PathEscape(req.SourceUrl),
+		cursorPlaceholder, url.PathEscape(req.Cursor),
+	)
+
+	requestUrl, err := url.Parse(pathReplacer.Replace(e.url))
+	if err != nil {
+		return "", err
+	}
+
+	// url.Values escapes query values itself.
+	queryReplacer := strings.NewReplacer(
+		nodePlaceholder, req.SourceUrl,
+		cursorPlaceholder, req.Cursor,
+	)
+
+	queryParams := requestUrl.Query()
+	for name, value := range e.query {
+		if req.Cursor == "" && strings.Contains(value, cursorPlaceholder) {
+			continue
+		}
+
+		queryParams.Set(name, queryReplacer.Replace(value))
+	}
+	requestUrl.RawQuery = queryParams.Encode()
+
+	return requestUrl.String(), nil
+}
+
+// scalarString formats a JSON string or number selected from a response.
+func scalarString(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case json.Number:
+		return value.String(), true
+	}
+
+	return "", false
+}
+
+// HTTPPlugin searches links of a REST API returning JSON, described by an
+// HTTPPluginConfig instead of Go code. Node ids are taken as they are.
+type HTTPPlugin struct {
+	name        string
+	links       *httpEndpoint
+	backlinks   *httpEndpoint
+	headers     map[string]string
+	client      *http.Client
+	queueConfig queue.Config
+}
+
+// NewHTTPPlugin creates the plugin described by config. The plugin advertises
+// backlinks if the config has a backlinks endpoint.
+func NewHTTPPlugin(config HTTPPluginConfig) (*HTTPPlugin, error) {
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := newHTTPEndpoint(config.Links)
+	if err != nil {
+		return nil, fmt.Errorf("http plugin %s: links: %w", config.Name, err)
+	}
+
+	var backlinks *httpEndpoint
+	if config.Backlinks != nil {
+		backlinks, err = newHTTPEndpoint(*config.Backlinks)
+		if err != nil {
+			return nil, fmt.Errorf("http plugin %s: backlinks: %w", config.Name, err)
+		}
+	}
+
+	limitGroup := config.Name
+	if linksUrl, err := url.Parse(config.Links.Url); err == nil {
+		limitGroup = linksUrl.Host
+	}
+
+	return &HTTPPlugin{
+		name:      config.Name,
+		links:     links,
+		backlinks: backlinks,
+		headers:   config.headers(),
+		client: &http.Client{
+			Timeout: time.Duration(config.TimeoutMs) * time.Millisecond,
+		},
+		queueConfig: config.Queue.queueConfig(limitGroup),
+	}, nil
+}
+
+func (p *HTTPPlugin) GetName() string {
+	return p.name
+}
+
+func (p *HTTPPlugin) Capabilities() plugin.Capabilities {
+	return plugin.Capabilities{
+		Backlinks: p.backlinks != nil,
+	}
+}
+
+// request calls the endpoint for req. A node the API doesn't know, i.e. a
+// 404 response, has no links.
+func (p *HTTPPlugin) request(endpoint *httpEndpoint, req plugin.Request) (*plugin.Response, error) {
+	requestUrl, err := endpoint.requestUrl(req)
+	if err != nil {
+		return nil, plugin.Permanent(err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return nil, plugin.Permanent(err)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	for name, value := range p.headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return &plugin.Response{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		httpErr := &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+		return nil, classifyError(httpErr, httpErr.IsTemporary(), resp.StatusCode == http.StatusTooManyRequests, resp.Header)
+	}
+
+	var doc interface{}
+
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxHTTPResponseSize))
+	decoder.UseNumber()
+	err = decoder.Decode(&doc)
+	if err != nil {
+		return nil, plugin.Permanent(fmt.Errorf("parsing response of %s: %w", requestUrl, err))
+	}
+
+	nodes := make([]string, 0)
+	for _, value := range endpoint.nodes.eval(doc) {
+		if value == nil {
+			continue
+		}
+
+		node, ok := scalarString(value)
+		if !ok {
+			return nil, plugin.Permanent(fmt.Errorf("nodes expression selected a non-scalar value in response of %s", requestUrl))
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	cursor := ""
+	if endpoint.cursor != nil {
+		if values := endpoint.cursor.eval(doc); len(values) > 0 {
+			cursor, _ = scalarString(values[0])
+		}
+	}
+	// An API returning the same cursor again would page forever.
+	if cursor == req.Cursor {
+		cursor = ""
+	}
+
+	return buildResponse(req, nodes, cursor), nil
+}
+
+func (p *HTTPPlugin) DoRequest(req plugin.Request) (*plugin.Response, error) {
+	return p.request(p.links, req)
+}
+
+func (p *HTTPPlugin) DoBacklinksRequest(req plugin.Request) (*plugin.Response, error) {
+	if p.backlinks == nil {
+		return nil, plugin.Permanent(errors.New("backlinks endpoint isn't configured"))
+	}
+
+	return p.request(p.backlinks, req)
+}
+
+func (p *HTTPPlugin) GetQueueConfig() queue.Config {
+	return p.queueConfig
+}
@@ -0,0 +1,138 @@
+package plugins
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type jsonPathStepKind int
+
+const (
+	jsonPathKey jsonPathStepKind = iota
+	jsonPathIndex
+	jsonPathWildcard
+)
+
+type jsonPathStep struct {
+	kind  jsonPathStepKind
+	key   string
+	index int
+}
+
+// jsonPath is a compiled JSONPath expression. The subset needed to pick
+// values out of API responses is supported: $ is the root, .name and
+// ['name'] select object members, [n] selects an array item, counting from
+// the end if it's negative, and .* and [*] select all members or items.
+type jsonPath []jsonPathStep
+
+func compileJSONPath(expr string) (jsonPath, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("jsonpath %s: has to start with $", expr)
+	}
+
+	path := jsonPath{}
+
+	for i := 1; i < len(expr); {
+		switch expr[i] {
+		case '.':
+			i++
+			if i < len(expr) && expr[i] == '.' {
+				return nil, fmt.Errorf("jsonpath %s: recursive descent .. isn't supported", expr)
+			}
+			if i < len(expr) && expr[i] == '*' {
+				path = append(path, jsonPathStep{kind: jsonPathWildcard})
+				i++
+				continue
+			}
+
+			end := i
+			for end < len(expr) && expr[end] != '.' && expr[end] != '[' {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("jsonpath %s: empty name at %d", expr, i)
+			}
+
+			path = append(path, jsonPathStep{kind: jsonPathKey, key: expr[i:end]})
+			i = end
+		case '[':
+			end := strings.IndexByte(expr[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath %s: unclosed [ at %d", expr, i)
+			}
+
+			selector := expr[i+1 : i+end]
+			i += end + 1
+
+			switch {
+			case selector == "*":
+				path = append(path, jsonPathStep{kind: jsonPathWildcard})
+			case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0] &&
+				strings.IndexByte(selector[1:len(selector)-1], selector[0]) < 0:
+				path = append(path, jsonPathStep{kind: jsonPathKey, key: selector[1 : len(selector)-1]})
+			default:
+				index, err := strconv.Atoi(selector)
+				if err != nil {
+					return nil, fmt.Errorf("jsonpath %s: unsupported selector [%s], only [n], ['name'] and [*] are supported", expr, selector)
+				}
+
+				path = append(path, jsonPathStep{kind: jsonPathIndex, index: index})
+			}
+		default:
+			return nil, fmt.Errorf("jsonpath %s: unexpected %q at %d", expr, expr[i], i)
+		}
+	}
+
+	return path, nil
+}
+
+// eval returns the values of doc, decoded by encoding/json, the path selects.
+// Members selected by a wildcard come in the order of their names.
+func (path jsonPath) eval(doc interface{}) []interface{} {
+	values := []interface{}{doc}
+
+	for _, step := range path {
+		selected := make([]interface{}, 0, len(values))
+
+		for _, value := range values {
+			switch value := value.(type) {
+			case map[string]interface{}:
+				switch step.kind {
+				case jsonPathKey:
+					if member, contains := value[step.key]; contains {
+						selected = append(selected, member)
+					}
+				case jsonPathWildcard:
+					keys := make([]string, 0, len(value))
+					for key := range value {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+
+					for _, key := range keys {
+						selected = append(selected, value[key])
+					}
+				}
+			case []interface{}:
+				switch step.kind {
+				case jsonPathIndex:
+					index := step.index
+					if index < 0 {
+						index += len(value)
+					}
+					if index >= 0 && index < len(value) {
+						selected = append(selected, value[index])
+					}
+				case jsonPathWildcard:
+					selected = append(selected, value...)
+				}
+			}
+		}
+
+		values = selected
+	}
+
+	return values
+}
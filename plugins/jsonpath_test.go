@@ -0,0 +1,84 @@
+package plugins
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCompileJSONPathRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"data.links",
+		"$.",
+		"$..links",
+		"$.data[0",
+		"$[1:2]",
+		"$[?(@.title)]",
+		"$data",
+		"$.items[0,1]",
+		"$['a','b']",
+	} {
+		if _, err := compileJSONPath(expr); err == nil {
+			t.Errorf("compileJSONPath(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestJSONPathEval(t *testing.T) {
+	const doc = `{
+		"query": {
+			"pages": {
+				"2": {"title": "Ulm", "links": [{"title": "Danube"}]},
+				"1": {"title": "Albert Einstein", "links": [{"title": "Physics"}, {"title": "Ulm"}]}
+			}
+		},
+		"continue": {"plcontinue": "1|0|Zurich"},
+		"items": ["a", "b", "c"],
+		"odd key": 1
+	}`
+
+	tests := []struct {
+		expr string
+		want []interface{}
+	}{
+		{"$.continue.plcontinue", []interface{}{"1|0|Zurich"}},
+		{"$['continue']['plcontinue']", []interface{}{"1|0|Zurich"}},
+		{`$["odd key"]`, []interface{}{1.0}},
+		{"$.items[0]", []interface{}{"a"}},
+		{"$.items[-1]", []interface{}{"c"}},
+		{"$.items[3]", []interface{}{}},
+		{"$.items[-4]", []interface{}{}},
+		{"$.items[*]", []interface{}{"a", "b", "c"}},
+		{"$.items.*", []interface{}{"a", "b", "c"}},
+		{"$.query.pages.*.title", []interface{}{"Albert Einstein", "Ulm"}},
+		{"$.query.pages[*].links[*].title", []interface{}{"Physics", "Ulm", "Danube"}},
+		{"$.query.pages.*.links[0].title", []interface{}{"Physics", "Danube"}},
+		{"$.missing.title", []interface{}{}},
+		{"$.items.title", []interface{}{}},
+		{"$.continue[0]", []interface{}{}},
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(doc), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		path, err := compileJSONPath(test.expr)
+		if err != nil {
+			t.Errorf("compileJSONPath(%q): %s", test.expr, err)
+			continue
+		}
+
+		got := path.eval(decoded)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s = %v, want %v", test.expr, got, test.want)
+		}
+	}
+
+	root, _ := compileJSONPath("$")
+	if got := root.eval(decoded); len(got) != 1 || !reflect.DeepEqual(got[0], decoded) {
+		t.Errorf("$ = %v, want the document", got)
+	}
+}
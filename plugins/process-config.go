@@ -0,0 +1,133 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	defaultHealthIntervalMs = 10000
+	defaultHealthTimeoutMs  = 5000
+	defaultRequestTimeoutMs = 60000
+)
+
+// ProcessPluginConfig describes a plugin running in its own process and
+// speaking JSON-RPC 2.0, a message per line, either over the stdin and stdout
+// of a command the seeker launches or over a TCP connection.
+type ProcessPluginConfig struct {
+	// Name overrides the name the plugin reports.
+	Name string `json:"name"`
+	// Command is the program and the arguments launching the plugin, e.g.
+	// ["python3", "plugins/org_chart.py"].
+	Command []string `json:"command"`
+	// Dir is the working directory of the command.
+	Dir string `json:"dir"`
+	// Env holds env variables added to the environment of the seeker for the
+	// command.
+	Env map[string]string `json:"env"`
+	// Address is the host:port of a plugin the seeker connects to instead of
+	// launching it.
+	Address string `json:"address"`
+	// HealthIntervalMs is the time between health checks. A plugin that
+	// doesn't answer a check in time is restarted.
+	HealthIntervalMs int `json:"health_interval_ms"`
+	// HealthTimeoutMs is the time an idle plugin has to answer a health
+	// check. Busy plugins aren't checked while they answer requests and have
+	// RequestTimeoutMs otherwise.
+	HealthTimeoutMs int `json:"health_timeout_ms"`
+	// RequestTimeoutMs is the time a plugin has to answer a request.
+	RequestTimeoutMs int `json:"request_timeout_ms"`
+	// Queue replaces the queue settings the plugin reports.
+	Queue *QueueConfig `json:"queue"`
+}
+
+func defaultProcessPluginConfig() ProcessPluginConfig {
+	return ProcessPluginConfig{
+		HealthIntervalMs: defaultHealthIntervalMs,
+		HealthTimeoutMs:  defaultHealthTimeoutMs,
+		RequestTimeoutMs: defaultRequestTimeoutMs,
+	}
+}
+
+// defaultProcessQueueConfig is used for settings the plugin doesn't report.
+func defaultProcessQueueConfig() QueueConfig {
+	return QueueConfig{
+		Burst:     1,
+		QueueSize: 25,
+		Workers:   1,
+	}
+}
+
+// LoadProcessPluginConfigs reads a JSON array of ProcessPluginConfig from
+// path.
+func LoadProcessPluginConfigs(path string) ([]ProcessPluginConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rawConfigs []json.RawMessage
+	err = json.NewDecoder(file).Decode(&rawConfigs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	configs := make([]ProcessPluginConfig, 0, len(rawConfigs))
+	for _, rawConfig := range rawConfigs {
+		config := defaultProcessPluginConfig()
+
+		err = json.Unmarshal(rawConfig, &config)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+// String names the plugin in logs before it reports its name.
+func (c ProcessPluginConfig) String() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	if c.Address != "" {
+		return c.Address
+	}
+	if len(c.Command) > 0 {
+		return strings.Join(c.Command, " ")
+	}
+
+	return "process plugin"
+}
+
+func (c ProcessPluginConfig) validate() error {
+	switch {
+	case len(c.Command) == 0 && c.Address == "":
+		return fmt.Errorf("process plugin %s: either command or address is required", c)
+	case len(c.Command) > 0 && c.Address != "":
+		return fmt.Errorf("process plugin %s: command can't be used along with address", c)
+	case c.HealthIntervalMs <= 0:
+		return fmt.Errorf("process plugin %s: health_interval_ms has to be positive", c)
+	case c.HealthTimeoutMs <= 0:
+		return fmt.Errorf("process plugin %s: health_timeout_ms has to be positive", c)
+	case c.RequestTimeoutMs <= 0:
+		return fmt.Errorf("process plugin %s: request_timeout_ms has to be positive", c)
+	}
+
+	return nil
+}
+
+// env returns the environment of the command.
+func (c ProcessPluginConfig) env() []string {
+	env := os.Environ()
+	for name, value := range c.Env {
+		env = append(env, name+"="+value)
+	}
+
+	return env
+}
@@ -0,0 +1,571 @@
+package plugins
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/queue"
+)
+
+const (
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+
+	// startTimeout is the time a plugin has to connect and to answer
+	// initialize.
+	startTimeout = 30 * time.Second
+)
+
+// Capabilities a process plugin can report in the initialize result.
+const (
+	capabilityBacklinks = "backlinks"
+	capabilityBatch     = "batch"
+	capabilityNormalize = "normalize"
+	capabilityResolve   = "resolve"
+	capabilityWeights   = "weights"
+)
+
+// errProcessDown is returned for requests made while a plugin is restarted.
+var errProcessDown = errors.New("plugin process is down")
+
+// processFilter is plugin.LinkFilter as it's sent to process plugins.
+type processFilter struct {
+	Namespaces         []int `json:"namespaces,omitempty"`
+	KeepRedirects      bool  `json:"keep_redirects"`
+	SkipDisambiguation bool  `json:"skip_disambiguation"`
+}
+
+// processRequest is the params of links and backlinks calls.
+type processRequest struct {
+	SourceUrl string        `json:"source_url"`
+	DestUrl   string        `json:"dest_url"`
+	Cursor    string        `json:"cursor"`
+	Filter    processFilter `json:"filter"`
+}
+
+type processConnection struct {
+	SourceUrl string  `json:"source_url"`
+	DestUrl   string  `json:"dest_url"`
+	Cursor    string  `json:"cursor"`
+	Weight    float64 `json:"weight"`
+}
+
+// processResponse is the result of links and backlinks calls.
+type processResponse struct {
+	Connections []processConnection `json:"connections"`
+}
+
+type processBatchRequest struct {
+	processRequest
+	Backward bool `json:"backward"`
+}
+
+type processBatchParams struct {
+	Requests []processBatchRequest `json:"requests"`
+}
+
+// processBatchResult is the outcome of a request of a batch call, either
+// connections or an error.
+type processBatchResult struct {
+	processResponse
+	Error *RPCError `json:"error"`
+}
+
+type processBatchResponse struct {
+	Results []processBatchResult `json:"results"`
+}
+
+type resolveParams struct {
+	Nodes []string `json:"nodes"`
+}
+
+// resolveResult lists canonical ids of the nodes, or the nodes that don't
+// exist.
+type resolveResult struct {
+	Nodes    []string `json:"nodes"`
+	NotFound []string `json:"not_found"`
+}
+
+// processInfo is the result of the initialize call.
+type processInfo struct {
+	Name         string      `json:"name"`
+	Queue        QueueConfig `json:"queue"`
+	Capabilities []string    `json:"capabilities"`
+	BatchSize    int         `json:"batch_size"`
+}
+
+func (info processInfo) can(capability string) bool {
+	for _, c := range info.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+
+	return false
+}
+
+type normalizeParams struct {
+	Url string `json:"url"`
+}
+
+type normalizeResult struct {
+	Node string `json:"node"`
+}
+
+// processInstance is a running plugin process or an open connection to a
+// plugin.
+type processInstance struct {
+	conn *rpcConn
+	// stop kills the process or closes the connection, conn is closed
+	// afterwards.
+	stop func()
+	// exited is closed once the process exits or the connection is closed.
+	exited  chan struct{}
+	started time.Time
+}
+
+// ProcessPlugin forwards requests to a plugin running in its own process, so
+// plugins can be written in any language. The process is health-checked and
+// restarted when it crashes or hangs. The plugin advertises the capabilities
+// the process reports.
+type ProcessPlugin struct {
+	config         ProcessPluginConfig
+	name           string
+	info           processInfo
+	queueConfig    queue.Config
+	healthTimeout  time.Duration
+	requestTimeout time.Duration
+
+	mu       sync.RWMutex
+	instance *processInstance
+
+	closeOnce  sync.Once
+	done       chan struct{}
+	supervised chan struct{}
+}
+
+// NewProcessPlugin starts the plugin described by config and asks it for its
+// name, queue settings and capabilities.
+func NewProcessPlugin(config ProcessPluginConfig) (*ProcessPlugin, error) {
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ProcessPlugin{
+		config:         config,
+		healthTimeout:  time.Duration(config.HealthTimeoutMs) * time.Millisecond,
+		requestTimeout: time.Duration(config.RequestTimeoutMs) * time.Millisecond,
+		done:           make(chan struct{}),
+		supervised:     make(chan struct{}),
+	}
+
+	instance, info, err := p.start()
+	if err != nil {
+		return nil, fmt.Errorf("process plugin %s: %w", config, err)
+	}
+
+	p.name = info.Name
+	if config.Name != "" {
+		p.name = config.Name
+	}
+	err = validateName(p.name)
+	if err != nil {
+		instance.stop()
+		return nil, fmt.Errorf("process plugin %s: %w", config, err)
+	}
+
+	queueConfig := info.Queue
+	if config.Queue != nil {
+		queueConfig = *config.Queue
+	}
+
+	p.info = info
+	p.queueConfig = queueConfig.queueConfig(p.name)
+	p.instance = instance
+
+	go p.supervise(instance)
+
+	return p, nil
+}
+
+// start launches or connects to the plugin and initializes it.
+func (p *ProcessPlugin) start() (*processInstance, processInfo, error) {
+	var (
+		instance *processInstance
+		err      error
+	)
+	if p.config.Address != "" {
+		instance, err = p.dial()
+	} else {
+		instance, err = p.launch()
+	}
+	if err != nil {
+		return nil, processInfo{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+
+	info := processInfo{Queue: defaultProcessQueueConfig()}
+	err = instance.conn.call(ctx, "initialize", nil, &info)
+	if err != nil {
+		instance.stop()
+		return nil, processInfo{}, err
+	}
+
+	return instance, info, nil
+}
+
+func (p *ProcessPlugin) launch() (*processInstance, error) {
+	cmd := exec.Command(p.config.Command[0], p.config.Command[1:]...)
+	cmd.Dir = p.config.Dir
+	cmd.Env = p.config.env()
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	go p.logOutput(stderr)
+
+	conn := newRPCConn(stdout, stdin)
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+
+		<-conn.closed
+		stdin.Close()
+		err := cmd.Wait()
+		if err != nil {
+			log.Printf("Plugin %s exited: %s\n", p.config, err)
+		}
+	}()
+
+	return &processInstance{
+		conn: conn,
+		stop: func() {
+			cmd.Process.Kill()
+		},
+		exited:  exited,
+		started: time.Now(),
+	}, nil
+}
+
+func (p *ProcessPlugin) dial() (*processInstance, error) {
+	netConn, err := net.DialTimeout("tcp", p.config.Address, startTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := newRPCConn(netConn, netConn)
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+
+		<-conn.closed
+		netConn.Close()
+	}()
+
+	return &processInstance{
+		conn: conn,
+		stop: func() {
+			netConn.Close()
+		},
+		exited:  exited,
+		started: time.Now(),
+	}, nil
+}
+
+// logOutput logs what the plugin writes to stderr.
+func (p *ProcessPlugin) logOutput(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		log.Printf("Plugin %s: %s\n", p.config, scanner.Text())
+	}
+}
+
+// supervise health-checks the running instance and replaces it once it stops,
+// backing off while the plugin keeps failing. It stops the instance and
+// returns once the plugin is closed.
+func (p *ProcessPlugin) supervise(instance *processInstance) {
+	defer close(p.supervised)
+
+	delay := minRestartDelay
+
+	for {
+		closed := !p.watch(instance)
+
+		p.mu.Lock()
+		p.instance = nil
+		p.mu.Unlock()
+
+		if closed {
+			instance.stop()
+			<-instance.exited
+			return
+		}
+
+		// A plugin that worked for a while is restarted right away.
+		if time.Since(instance.started) > maxRestartDelay {
+			delay = minRestartDelay
+		}
+
+		for {
+			log.Printf("Restarting plugin %s in %s...\n", p.name, delay)
+			select {
+			case <-p.done:
+				return
+			case <-time.After(delay):
+			}
+
+			if delay *= 2; delay > maxRestartDelay {
+				delay = maxRestartDelay
+			}
+
+			var (
+				info processInfo
+				err  error
+			)
+			instance, info, err = p.start()
+			if err != nil {
+				log.Printf("Couldn't restart plugin %s: %s\n", p.name, err)
+				continue
+			}
+
+			if info.Name != p.info.Name || strings.Join(info.Capabilities, ",") != strings.Join(p.info.Capabilities, ",") {
+				log.Printf("Plugin %s reported a different name or capabilities after restart, keeping the ones reported first\n", p.name)
+			}
+			break
+		}
+
+		log.Printf("Restarted plugin %s\n", p.name)
+
+		p.mu.Lock()
+		p.instance = instance
+		p.mu.Unlock()
+	}
+}
+
+// watch returns true once the instance stops and false once the plugin is
+// closed. An instance that fails a health check or stops reading requests is
+// stopped.
+func (p *ProcessPlugin) watch(instance *processInstance) bool {
+	interval := time.Duration(p.config.HealthIntervalMs) * time.Millisecond
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return false
+		case <-instance.conn.closed:
+			log.Printf("Plugin %s stopped\n", p.name)
+			return true
+		case <-instance.conn.stalled:
+			log.Printf("Plugin %s stopped reading requests\n", p.name)
+			instance.stop()
+			<-instance.conn.closed
+			return true
+		case <-ticker.C:
+			timeout := p.healthTimeout
+			if pending, lastResponse := instance.conn.activity(); pending > 0 {
+				// A busy plugin that answered lately is alive. Otherwise a
+				// plugin handling one message at a time answers the ping once
+				// the requests before are done.
+				if time.Since(lastResponse) < interval {
+					continue
+				}
+				timeout = p.requestTimeout
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err := instance.conn.call(ctx, "ping", nil, nil)
+			cancel()
+
+			if err != nil {
+				log.Printf("Plugin %s failed health check: %s\n", p.name, err)
+				instance.stop()
+				<-instance.conn.closed
+				return true
+			}
+		}
+	}
+}
+
+// Close stops supervising the plugin, kills its process or closes the
+// connection to it and waits for it to exit. Requests made afterwards fail.
+func (p *ProcessPlugin) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+	<-p.supervised
+
+	return nil
+}
+
+// call calls method of the running instance.
+func (p *ProcessPlugin) call(method string, params, result interface{}) error {
+	p.mu.RLock()
+	instance := p.instance
+	p.mu.RUnlock()
+
+	if instance == nil {
+		return errProcessDown
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.requestTimeout)
+	defer cancel()
+
+	return instance.conn.call(ctx, method, params, result)
+}
+
+func (p *ProcessPlugin) GetName() string {
+	return p.name
+}
+
+func (p *ProcessPlugin) Capabilities() plugin.Capabilities {
+	return plugin.Capabilities{
+		Backlinks: p.info.can(capabilityBacklinks),
+		Batch:     p.info.can(capabilityBatch),
+		BatchSize: p.info.BatchSize,
+		Normalize: p.info.can(capabilityNormalize),
+		Resolve:   p.info.can(capabilityResolve),
+		Weights:   p.info.can(capabilityWeights),
+	}
+}
+
+// Normalize calls normalize of the plugin.
+func (p *ProcessPlugin) Normalize(url string) (string, error) {
+	var result normalizeResult
+	err := p.call("normalize", normalizeParams{Url: url}, &result)
+	if err != nil {
+		return "", err
+	}
+	if result.Node == "" {
+		return "", plugin.Permanent(fmt.Errorf("plugin %s normalized %q to an empty node id", p.name, url))
+	}
+
+	return result.Node, nil
+}
+
+// Resolve calls resolve of the plugin.
+func (p *ProcessPlugin) Resolve(nodes []string) ([]string, error) {
+	var result resolveResult
+	err := p.call("resolve", resolveParams{Nodes: nodes}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.NotFound) > 0 {
+		return nil, &plugin.NotFoundError{Nodes: result.NotFound}
+	}
+	if len(result.Nodes) != len(nodes) {
+		return nil, fmt.Errorf("plugin %s resolved %d nodes to %d", p.name, len(nodes), len(result.Nodes))
+	}
+
+	return result.Nodes, nil
+}
+
+func newProcessRequest(req plugin.Request) processRequest {
+	return processRequest{
+		SourceUrl: req.SourceUrl,
+		DestUrl:   req.DestUrl,
+		Cursor:    req.Cursor,
+		Filter: processFilter{
+			Namespaces:         req.Filter.Namespaces,
+			KeepRedirects:      req.Filter.KeepRedirects,
+			SkipDisambiguation: req.Filter.SkipDisambiguation,
+		},
+	}
+}
+
+func (r processResponse) response() *plugin.Response {
+	connections := make([]plugin.Connection, 0, len(r.Connections))
+	for _, connection := range r.Connections {
+		connections = append(connections, plugin.Connection{
+			SourceUrl: connection.SourceUrl,
+			DestUrl:   connection.DestUrl,
+			Cursor:    connection.Cursor,
+			Weight:    connection.Weight,
+		})
+	}
+
+	return &plugin.Response{
+		Connections: connections,
+	}
+}
+
+func (p *ProcessPlugin) request(method string, req plugin.Request) (*plugin.Response, error) {
+	var result processResponse
+	err := p.call(method, newProcessRequest(req), &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.response(), nil
+}
+
+// DoRequest calls links of the plugin.
+func (p *ProcessPlugin) DoRequest(req plugin.Request) (*plugin.Response, error) {
+	return p.request("links", req)
+}
+
+// DoBacklinksRequest calls backlinks of the plugin.
+func (p *ProcessPlugin) DoBacklinksRequest(req plugin.Request) (*plugin.Response, error) {
+	return p.request("backlinks", req)
+}
+
+// DoBatchRequest calls batch of the plugin.
+func (p *ProcessPlugin) DoBatchRequest(reqs []plugin.BatchRequest) ([]plugin.BatchResult, error) {
+	params := processBatchParams{
+		Requests: make([]processBatchRequest, 0, len(reqs)),
+	}
+	for _, req := range reqs {
+		params.Requests = append(params.Requests, processBatchRequest{newProcessRequest(req.Request), req.Backward})
+	}
+
+	var result processBatchResponse
+	err := p.call("batch", params, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]plugin.BatchResult, 0, len(result.Results))
+	for _, batchResult := range result.Results {
+		if batchResult.Error != nil {
+			results = append(results, plugin.BatchResult{Err: batchResult.Error.classify()})
+			continue
+		}
+
+		results = append(results, plugin.BatchResult{Response: batchResult.response()})
+	}
+
+	return results, nil
+}
+
+func (p *ProcessPlugin) GetQueueConfig() queue.Config {
+	return p.queueConfig
+}
@@ -0,0 +1,181 @@
+package plugins
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+)
+
+// testPluginEnv holds the mode of the helper plugin.
+const testPluginEnv = "HANDSHAKES_TEST_PROCESS_PLUGIN"
+
+const (
+	// sleeperPlugin handles one message at a time, links sleeps for the
+	// duration given as source_url.
+	sleeperPlugin = "sleeper"
+	// deafPlugin stops reading stdin once it's initialized.
+	deafPlugin = "deaf"
+)
+
+// TestHelperProcessPlugin isn't a test, it's the plugin the tests below
+// launch in the mode set by testPluginEnv.
+func TestHelperProcessPlugin(t *testing.T) {
+	mode := os.Getenv(testPluginEnv)
+	if mode == "" {
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	encoder := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		var req struct {
+			Id     uint64         `json:"id"`
+			Method string         `json:"method"`
+			Params processRequest `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			os.Exit(1)
+		}
+
+		var result interface{} = struct{}{}
+		switch req.Method {
+		case "initialize":
+			result = processInfo{Name: "sleeper"}
+		case "links":
+			delay, _ := time.ParseDuration(req.Params.SourceUrl)
+			time.Sleep(delay)
+			result = processResponse{Connections: []processConnection{{SourceUrl: "awake", DestUrl: req.Params.DestUrl}}}
+		}
+
+		encoder.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "result": result})
+
+		if mode == deafPlugin {
+			select {}
+		}
+	}
+
+	os.Exit(0)
+}
+
+func startTestProcessPlugin(t *testing.T, config ProcessPluginConfig, mode string) *ProcessPlugin {
+	t.Helper()
+
+	config.Command = []string{os.Args[0], "-test.run=^TestHelperProcessPlugin$"}
+	config.Env = map[string]string{testPluginEnv: mode}
+
+	p, err := NewProcessPlugin(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+
+	return p
+}
+
+func TestProcessPluginClose(t *testing.T) {
+	p := startTestProcessPlugin(t, defaultProcessPluginConfig(), sleeperPlugin)
+
+	p.mu.RLock()
+	instance := p.instance
+	p.mu.RUnlock()
+
+	err := p.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-instance.exited:
+	default:
+		t.Fatal("process is running after Close")
+	}
+
+	_, err = p.DoRequest(plugin.Request{SourceUrl: "0s", DestUrl: "b"})
+	if err != errProcessDown {
+		t.Errorf("request after Close: error = %v, want %v", err, errProcessDown)
+	}
+
+	// Closing twice is fine.
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessPluginKeepsBusyPluginRunning(t *testing.T) {
+	config := defaultProcessPluginConfig()
+	config.HealthIntervalMs = 20
+	config.HealthTimeoutMs = 20
+	p := startTestProcessPlugin(t, config, sleeperPlugin)
+
+	p.mu.RLock()
+	instance := p.instance
+	p.mu.RUnlock()
+
+	// The plugin can't answer pings while it sleeps, which takes longer than
+	// the health timeout.
+	resp, err := p.DoRequest(plugin.Request{SourceUrl: "300ms", DestUrl: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Connections) != 1 || resp.Connections[0].SourceUrl != "awake" {
+		t.Errorf("connections = %+v", resp.Connections)
+	}
+
+	p.mu.RLock()
+	restarted := p.instance != instance
+	p.mu.RUnlock()
+	if restarted {
+		t.Error("busy plugin was restarted")
+	}
+}
+
+func TestProcessPluginRestartsPluginNotReadingRequests(t *testing.T) {
+	config := defaultProcessPluginConfig()
+	config.RequestTimeoutMs = 100
+	// Restarts aren't caused by health checks.
+	config.HealthIntervalMs = 60000
+	p := startTestProcessPlugin(t, config, deafPlugin)
+
+	p.mu.RLock()
+	instance := p.instance
+	p.mu.RUnlock()
+
+	// The request is larger than a pipe holds.
+	source := strings.Repeat("x", 1<<20)
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		_, err := p.DoRequest(plugin.Request{SourceUrl: source, DestUrl: "b"})
+		if err == nil {
+			t.Fatal("request to a plugin not reading requests succeeded")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("request %d returned after %s", i, elapsed)
+		}
+	}
+
+	select {
+	case <-instance.exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugin not reading requests wasn't stopped")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p.mu.RLock()
+		restarted := p.instance != nil && p.instance != instance
+		p.mu.RUnlock()
+		if restarted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("plugin wasn't restarted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
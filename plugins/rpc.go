@@ -0,0 +1,244 @@
+package plugins
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+)
+
+// maxRPCMessageSize limits the size of a message read from a plugin.
+const maxRPCMessageSize = 64 << 20
+
+// errConnClosed is returned for calls on a connection that was closed or
+// broke before they were answered.
+var errConnClosed = errors.New("plugin connection is closed")
+
+// errWriteStalled is returned for calls whose request couldn't be written
+// before they timed out, the plugin stopped reading requests.
+var errWriteStalled = errors.New("plugin stopped reading requests")
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Id      uint64      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Id      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *RPCError       `json:"error"`
+}
+
+// RPCErrorData tells the seeker how to handle a failed request.
+type RPCErrorData struct {
+	// Permanent marks errors that won't go away if the request is retried.
+	Permanent bool `json:"permanent"`
+	// RetryAfterMs asks to back off the plugin queue for that long.
+	RetryAfterMs int `json:"retry_after_ms"`
+}
+
+// RPCError is the error object of a JSON-RPC 2.0 response.
+type RPCError struct {
+	Code    int           `json:"code"`
+	Message string        `json:"message"`
+	Data    *RPCErrorData `json:"data"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("plugin error %d: %s", e.Code, e.Message)
+}
+
+// classify marks the error for the retry policy of the seeker.
+func (e *RPCError) classify() error {
+	if e.Data == nil {
+		return e
+	}
+	if e.Data.Permanent {
+		return plugin.Permanent(e)
+	}
+	if e.Data.RetryAfterMs > 0 {
+		return plugin.RetryAfter(e, time.Duration(e.Data.RetryAfterMs)*time.Millisecond)
+	}
+
+	return e
+}
+
+// rpcConn is a JSON-RPC 2.0 client sending a message per line, so calls can
+// be made concurrently over a single pipe or socket.
+type rpcConn struct {
+	w io.Writer
+	// writing is held while a request is written, so requests aren't
+	// interleaved. It's a channel, so calls waiting for it can time out.
+	writing chan struct{}
+	// stalled is closed once a request couldn't be written in time. The
+	// connection is broken then, as a part of the request may have been
+	// written, and has to be closed by its owner.
+	stalled     chan struct{}
+	stalledOnce sync.Once
+
+	mu      sync.Mutex
+	nextId  uint64
+	pending map[uint64]chan *rpcResponse
+	err     error
+	// lastResponse is the time the last response arrived.
+	lastResponse time.Time
+
+	closed chan struct{}
+}
+
+// newRPCConn starts reading responses from r. The connection is closed once
+// r ends.
+func newRPCConn(r io.Reader, w io.Writer) *rpcConn {
+	conn := &rpcConn{
+		w:       w,
+		writing: make(chan struct{}, 1),
+		stalled: make(chan struct{}),
+		pending: make(map[uint64]chan *rpcResponse),
+		closed:  make(chan struct{}),
+	}
+
+	go conn.readLoop(r)
+
+	return conn
+}
+
+func (c *rpcConn) readLoop(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRPCMessageSize)
+
+	for scanner.Scan() {
+		var resp rpcResponse
+		// Lines that aren't responses, e.g. debug output, are skipped.
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil || resp.JSONRPC != "2.0" {
+			continue
+		}
+
+		c.mu.Lock()
+		respCh, contains := c.pending[resp.Id]
+		delete(c.pending, resp.Id)
+		c.lastResponse = time.Now()
+		c.mu.Unlock()
+
+		if contains {
+			respCh <- &resp
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+
+	c.mu.Lock()
+	c.err = err
+	for id, respCh := range c.pending {
+		close(respCh)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+
+	close(c.closed)
+}
+
+// activity returns the number of calls waiting for a response and the time
+// the last response arrived.
+func (c *rpcConn) activity() (int, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.pending), c.lastResponse
+}
+
+// write writes a message unless ctx is done first. A write that doesn't
+// complete in time stalls the connection, it's left to finish or to fail once
+// the connection is closed.
+func (c *rpcConn) write(ctx context.Context, message []byte) error {
+	select {
+	case c.writing <- struct{}{}:
+	case <-c.stalled:
+		return errWriteStalled
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := c.w.Write(message)
+		<-c.writing
+		written <- err
+	}()
+
+	select {
+	case err := <-written:
+		return err
+	case <-ctx.Done():
+		c.stalledOnce.Do(func() {
+			close(c.stalled)
+		})
+		return errWriteStalled
+	}
+}
+
+// call sends a request and decodes its result into result, unless it's nil.
+// Errors returned by the plugin are *RPCError marked as the plugin asks,
+// other errors are retryable.
+func (c *rpcConn) call(ctx context.Context, method string, params, result interface{}) error {
+	respCh := make(chan *rpcResponse, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return errConnClosed
+	}
+	c.nextId++
+	id := c.nextId
+	c.pending[id] = respCh
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	message, err := json.Marshal(rpcRequest{JSONRPC: "2.0", Id: id, Method: method, Params: params})
+	if err != nil {
+		return plugin.Permanent(err)
+	}
+
+	err = c.write(ctx, append(message, '\n'))
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	case resp, ok := <-respCh:
+		if !ok {
+			return fmt.Errorf("%s: %w", method, errConnClosed)
+		}
+		if resp.Error != nil {
+			return resp.Error.classify()
+		}
+		if result == nil {
+			return nil
+		}
+
+		err = json.Unmarshal(resp.Result, result)
+		if err != nil {
+			return plugin.Permanent(fmt.Errorf("%s: parsing result: %w", method, err))
+		}
+
+		return nil
+	}
+}
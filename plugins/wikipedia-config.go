@@ -0,0 +1,146 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/aconfig"
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/queue"
+)
+
+const (
+	defaultWikipediaName     = "wikipedia"
+	defaultWikipediaLanguage = "en"
+	// mainNamespace holds the articles of a site.
+	mainNamespace = 0
+)
+
+// WikipediaConfig describes a MediaWiki site searched by a WikipediaPlugin.
+type WikipediaConfig struct {
+	// Name is the name of the plugin and the data_source of its tasks.
+	Name string `json:"name"`
+	// ApiUrl is the api.php endpoint of the site, e.g.
+	// https://en.wiktionary.org/w/api.php. Defaults to the Wikipedia in
+	// Language.
+	ApiUrl string `json:"api_url"`
+	// Language picks the Wikipedia if ApiUrl isn't set. Defaults to "en".
+	Language string `json:"language"`
+	// Namespaces limits links to pages of the given namespaces. Defaults to
+	// the main namespace, i.e. articles. Links to any namespace are followed
+	// if it's set to an empty list.
+	Namespaces []int `json:"namespaces"`
+	// CaseSensitive keeps the first letter of titles as it is instead of
+	// capitalising it, e.g. on Wiktionary.
+	CaseSensitive bool `json:"case_sensitive"`
+	// Queue fields missing from the sites file default to the
+	// HANDSHAKES_WIKI_* env variables.
+	Queue QueueConfig `json:"queue"`
+}
+
+func defaultWikipediaQueueConfig() QueueConfig {
+	return QueueConfig{
+		DelayMs:     aconfig.GetEnvOrInt("HANDSHAKES_WIKI_PLUGIN_DELAY", 500),
+		Burst:       aconfig.GetEnvOrInt("HANDSHAKES_WIKI_BURST", 1),
+		Concurrency: aconfig.GetEnvOrInt("HANDSHAKES_WIKI_CONCURRENCY", 1),
+		QueueSize:   uint(aconfig.GetEnvOrInt("HANDSHAKES_WIKI_QUEUE_SIZE", 25)),
+		Workers:     uint(aconfig.GetEnvOrInt("HANDSHAKES_WIKI_WORKERS", 1)),
+	}
+}
+
+// DefaultWikipediaConfig is the English Wikipedia with queue settings taken
+// from the env.
+func DefaultWikipediaConfig() WikipediaConfig {
+	return WikipediaConfig{
+		Name:       defaultWikipediaName,
+		Language:   defaultWikipediaLanguage,
+		Namespaces: []int{mainNamespace},
+		Queue:      defaultWikipediaQueueConfig(),
+	}
+}
+
+// LoadWikipediaConfigs reads a JSON array of WikipediaConfig from path.
+func LoadWikipediaConfigs(path string) ([]WikipediaConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rawConfigs []json.RawMessage
+	err = json.NewDecoder(file).Decode(&rawConfigs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	configs := make([]WikipediaConfig, 0, len(rawConfigs))
+	for _, rawConfig := range rawConfigs {
+		config := WikipediaConfig{
+			Namespaces: []int{mainNamespace},
+			Queue:      defaultWikipediaQueueConfig(),
+		}
+
+		err = json.Unmarshal(rawConfig, &config)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+// apiUrl returns the api.php endpoint of the site.
+func (c WikipediaConfig) apiUrl() string {
+	if c.ApiUrl != "" {
+		return c.ApiUrl
+	}
+
+	language := c.Language
+	if language == "" {
+		language = defaultWikipediaLanguage
+	}
+
+	return fmt.Sprintf("https://%s.wikipedia.org/w/api.php", language)
+}
+
+func (c WikipediaConfig) validate() error {
+	err := validateName(c.Name)
+	if err != nil {
+		return fmt.Errorf("site %w", err)
+	}
+
+	apiUrl, err := url.Parse(c.apiUrl())
+	if err != nil {
+		return fmt.Errorf("site %s: %w", c.Name, err)
+	}
+	if apiUrl.Host == "" || (apiUrl.Scheme != "http" && apiUrl.Scheme != "https") {
+		return fmt.Errorf("site %s: api url %q has to be an absolute http(s) url", c.Name, c.apiUrl())
+	}
+
+	return nil
+}
+
+// formatNamespaces formats namespaces as a MediaWiki multi-value parameter.
+func formatNamespaces(namespaces []int) string {
+	values := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		values = append(values, fmt.Sprint(namespace))
+	}
+
+	return strings.Join(values, "|")
+}
+
+// queueConfig builds the queue.Config of the site. Sites on the same host
+// share rate limits of the first of them.
+func (c WikipediaConfig) queueConfig() queue.Config {
+	limitGroup := c.Name
+	if apiUrl, err := url.Parse(c.apiUrl()); err == nil {
+		limitGroup = apiUrl.Host
+	}
+
+	return c.Queue.queueConfig(limitGroup)
+}
@@ -0,0 +1,96 @@
+package plugins
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+)
+
+// defaultRetryAfter is the back off used when the API asks to slow down
+// without saying for how long.
+const defaultRetryAfter = 5 * time.Second
+
+// APIError is the error object returned by the MediaWiki API, see
+// https://www.mediawiki.org/wiki/API:Errors_and_warnings.
+type APIError struct {
+	Code string `json:"code"`
+	Info string `json:"info"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("mediawiki api error %s: %s", e.Code, e.Info)
+}
+
+// IsThrottled reports whether the API asks the client to slow down.
+func (e *APIError) IsThrottled() bool {
+	return e.Code == "maxlag" || e.Code == "ratelimited"
+}
+
+// IsTemporary reports whether the request may succeed if it's retried.
+func (e *APIError) IsTemporary() bool {
+	return e.IsThrottled() ||
+		e.Code == "readonly" ||
+		strings.HasPrefix(e.Code, "internal_api_error")
+}
+
+// HTTPError is a response of an API with an unexpected status.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("api responded with %s", e.Status)
+}
+
+// IsTemporary reports whether the request may succeed if it's retried.
+func (e *HTTPError) IsTemporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode >= http.StatusInternalServerError
+}
+
+// parseRetryAfter reads the Retry-After header, given either in seconds or as
+// an HTTP date.
+func parseRetryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if after := time.Until(date); after > 0 {
+			return after, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// classifyError marks err for the retry policy of the seeker: throttling
+// errors carry the time to back off, errors that won't go away on retry are
+// permanent.
+func classifyError(err error, temporary, throttled bool, header http.Header) error {
+	if !temporary {
+		return plugin.Permanent(err)
+	}
+
+	after, ok := parseRetryAfter(header)
+	if !ok && throttled {
+		after, ok = defaultRetryAfter, true
+	}
+	if ok {
+		return plugin.RetryAfter(err, after)
+	}
+
+	return err
+}
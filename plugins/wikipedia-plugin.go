@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/malcolmmadsheep/handshakes-seeker/pkg/aconfig"
@@ -12,62 +14,115 @@ import (
 	"github.com/malcolmmadsheep/handshakes-seeker/pkg/queue"
 )
 
-const WIKIPEDIA_API_BASE_URL = "https://en.wikipedia.org/w/api.php"
+// defaultUserAgent identifies the client as the Wikimedia User-Agent policy
+// requires, see https://meta.wikimedia.org/wiki/User-Agent_policy.
+const defaultUserAgent = "handshakes-seeker/1.0 (https://github.com/malcolmmadsheep/handshakes-seeker)"
 
 type Page struct {
-	Title string `json:"title"`
-	Links [](struct {
-		Title string `json:"title"`
-	}) `json:"links"`
+	Title     string            `json:"title"`
+	PageProps map[string]string `json:"pageprops"`
+	// InvalidReason is set for titles the site doesn't allow.
+	InvalidReason string `json:"invalidreason"`
+	// Missing is set for pages that don't exist.
+	Missing *string `json:"missing"`
+}
+
+// Redirect is a redirect or a normalization of a title done by the API.
+type Redirect struct {
+	From string `json:"from"`
+	To   string `json:"to"`
 }
 
 type WikipediaLinksResponse struct {
-	Continue struct {
-		Plcontinue string `json:"plcontinue"`
-	} `json:"continue"`
-	Query struct {
-		Pages map[string]json.RawMessage `json:"pages"`
+	// Continue holds the parameters continuing the listing, see
+	// https://www.mediawiki.org/wiki/API:Continue.
+	Continue map[string]string `json:"continue"`
+	Query    struct {
+		Pages      map[string]json.RawMessage `json:"pages"`
+		Normalized []Redirect                 `json:"normalized"`
+		Redirects  []Redirect                 `json:"redirects"`
 	} `json:"query"`
+	Error *APIError `json:"error"`
 }
 
+// WikipediaPlugin searches links between pages of a MediaWiki site, by
+// default the English Wikipedia.
 type WikipediaPlugin struct {
+	name        string
+	apiUrl      string
+	namespaces  string
+	queueConfig queue.Config
+	// caseSensitive keeps the first letter of titles as it is.
+	caseSensitive bool
+
+	client    *http.Client
+	userAgent string
+	// maxLag makes the API refuse requests while replication lag is higher
+	// than maxLag seconds, 0 disables the check.
+	maxLag int
+}
+
+func NewWikipediaPlugin(config WikipediaConfig) (*WikipediaPlugin, error) {
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &WikipediaPlugin{
+		name:          config.Name,
+		apiUrl:        config.apiUrl(),
+		namespaces:    formatNamespaces(config.Namespaces),
+		queueConfig:   config.queueConfig(),
+		caseSensitive: config.CaseSensitive,
+		client: &http.Client{
+			Transport: &http.Transport{
+				MaxIdleConns:       10,
+				IdleConnTimeout:    30 * time.Second,
+				DisableCompression: true,
+			},
+			Timeout: 30 * time.Second,
+		},
+		userAgent: aconfig.GetEnvOrString("HANDSHAKES_WIKI_USER_AGENT", defaultUserAgent),
+		maxLag:    aconfig.GetEnvOrInt("HANDSHAKES_WIKI_MAXLAG", 5),
+	}, nil
 }
 
 func (p *WikipediaPlugin) GetName() string {
-	return "wikipedia"
+	return p.name
 }
 
-func (p *WikipediaPlugin) DoRequest(req plugin.Request) (*plugin.Response, error) {
-	tr := &http.Transport{
-		MaxIdleConns:       10,
-		IdleConnTimeout:    30 * time.Second,
-		DisableCompression: true,
+func (p *WikipediaPlugin) query(queryParams url.Values) (*WikipediaLinksResponse, []Page, error) {
+	if p.maxLag > 0 {
+		queryParams.Set("maxlag", strconv.Itoa(p.maxLag))
 	}
-	client := &http.Client{Transport: tr}
 
-	queryParams := url.Values{
-		"action":  {"query"},
-		"format":  {"json"},
-		"prop":    {"links"},
-		"pllimit": {"max"},
-		"titles":  {req.SourceUrl},
+	apiUrl := fmt.Sprintf("%s?%s", p.apiUrl, queryParams.Encode())
+	req, err := http.NewRequest(http.MethodGet, apiUrl, nil)
+	if err != nil {
+		return nil, nil, plugin.Permanent(err)
 	}
+	req.Header.Set("User-Agent", p.userAgent)
 
-	if req.Cursor != "" {
-		queryParams.Add("plcontinue", req.Cursor)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, err
 	}
+	defer resp.Body.Close()
 
-	apiUrl := fmt.Sprintf("%s?%s", WIKIPEDIA_API_BASE_URL, queryParams.Encode())
-	resp, err := client.Get(apiUrl)
-	if err != nil {
-		return nil, err
+	if resp.StatusCode != http.StatusOK {
+		httpErr := &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+		return nil, nil, classifyError(httpErr, httpErr.IsTemporary(), resp.StatusCode == http.StatusTooManyRequests, resp.Header)
 	}
 
 	var linksResponse WikipediaLinksResponse
 
 	err = json.NewDecoder(resp.Body).Decode(&linksResponse)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if apiErr := linksResponse.Error; apiErr != nil {
+		return nil, nil, classifyError(apiErr, apiErr.IsTemporary(), apiErr.IsThrottled(), resp.Header)
 	}
 
 	pages := make([]Page, 0)
@@ -85,44 +140,156 @@ func (p *WikipediaPlugin) DoRequest(req plugin.Request) (*plugin.Response, error
 		pages = append(pages, page)
 	}
 
-	pagesCount := 1
+	return &linksResponse, pages, nil
+}
 
-	for _, page := range pages {
-		pagesCount += len(page.Links)
+// encodeCursor keeps the whole continue object of a response, the API expects
+// all of it back to continue the listing.
+func encodeCursor(continueParams map[string]string) string {
+	if len(continueParams) == 0 {
+		return ""
+	}
+
+	values := url.Values{}
+	for key, value := range continueParams {
+		values.Set(key, value)
+	}
+
+	return values.Encode()
+}
+
+// decodeCursor reads a cursor made by encodeCursor. Cursors of tasks queued
+// by older versions hold just the value of the key parameter.
+func decodeCursor(cursor, key string) url.Values {
+	if cursor == "" {
+		return nil
+	}
+
+	values, err := url.ParseQuery(cursor)
+	if err != nil || values.Get("continue") == "" {
+		return url.Values{key: {cursor}}
+	}
+
+	return values
+}
+
+// linksQuery builds the query listing pages connected to req.SourceUrl by the
+// generator, whose parameters start with prefix.
+func (p *WikipediaPlugin) linksQuery(req plugin.Request, generator, prefix string) url.Values {
+	queryParams := url.Values{
+		"action":         {"query"},
+		"format":         {"json"},
+		"generator":      {generator},
+		prefix + "limit": {"max"},
+		"titles":         {req.SourceUrl},
+	}
+
+	namespaces := p.namespaces
+	if req.Filter.Namespaces != nil {
+		namespaces = formatNamespaces(req.Filter.Namespaces)
+	}
+	if namespaces != "" {
+		queryParams.Set(prefix+"namespace", namespaces)
 	}
 
-	pageConnections := make([]plugin.Connection, 0, len(pages)+1)
+	// Resolves redirects both in titles and in generated pages.
+	if !req.Filter.KeepRedirects {
+		queryParams.Set("redirects", "1")
+	}
+	if req.Filter.SkipDisambiguation {
+		queryParams.Set("prop", "pageprops")
+		queryParams.Set("ppprop", "disambiguation")
+	}
+
+	for key, values := range decodeCursor(req.Cursor, prefix+"continue") {
+		queryParams[key] = values
+	}
+
+	return queryParams
+}
+
+// linkedTitles lists titles of the generated pages without disambiguation
+// pages, if the filter drops them. A page req.DestUrl redirects to keeps the
+// title of req.DestUrl, so the destination is found by the name it's searched
+// by.
+func linkedTitles(req plugin.Request, linksResponse *WikipediaLinksResponse, pages []Page) []string {
+	destAliases := make(map[string]bool)
+	for _, redirect := range linksResponse.Query.Redirects {
+		if redirect.From == req.DestUrl {
+			destAliases[redirect.To] = true
+		}
+	}
 
+	titles := make([]string, 0, len(pages))
 	for _, page := range pages {
-		for _, link := range page.Links {
-			pageConnections = append(pageConnections, plugin.Connection{
-				SourceUrl: link.Title,
-				DestUrl:   req.DestUrl,
-			})
+		if _, contains := page.PageProps["disambiguation"]; contains && req.Filter.SkipDisambiguation {
+			continue
+		}
+
+		title := page.Title
+		if destAliases[title] {
+			title = req.DestUrl
 		}
+
+		titles = append(titles, title)
+	}
+
+	// Pages come in a map, sorting keeps the order of the search stable.
+	sort.Strings(titles)
+
+	return titles
+}
+
+func buildResponse(req plugin.Request, titles []string, cursor string) *plugin.Response {
+	pageConnections := make([]plugin.Connection, 0, len(titles)+1)
+
+	for _, title := range titles {
+		pageConnections = append(pageConnections, plugin.Connection{
+			SourceUrl: title,
+			DestUrl:   req.DestUrl,
+		})
 	}
 
-	if linksResponse.Continue.Plcontinue != "" {
+	if cursor != "" {
 		pageConnections = append(pageConnections, plugin.Connection{
 			SourceUrl: req.SourceUrl,
 			DestUrl:   req.DestUrl,
-			Cursor:    linksResponse.Continue.Plcontinue,
+			Cursor:    cursor,
 		})
 	}
 
-	response := plugin.Response{
+	return &plugin.Response{
 		Connections: pageConnections,
 	}
+}
+
+// DoRequest lists pages req.SourceUrl links to using generator=links.
+func (p *WikipediaPlugin) DoRequest(req plugin.Request) (*plugin.Response, error) {
+	linksResponse, pages, err := p.query(p.linksQuery(req, "links", "gpl"))
+	if err != nil {
+		return nil, err
+	}
 
-	return &response, nil
+	return buildResponse(req, linkedTitles(req, linksResponse, pages), encodeCursor(linksResponse.Continue)), nil
 }
 
-func (p *WikipediaPlugin) GetQueueConfig() queue.Config {
-	delayInMs := aconfig.GetEnvOrInt("HANDSHAKES_WIKI_PLUGIN_DELAY", 500)
-	queueSize := aconfig.GetEnvOrInt("HANDSHAKES_WIKI_QUEUE_SIZE", 25)
+// DoBacklinksRequest lists pages linking to req.SourceUrl using
+// generator=linkshere. Redirects to req.SourceUrl are left out unless the
+// filter keeps them, pages linking through them aren't listed.
+func (p *WikipediaPlugin) DoBacklinksRequest(req plugin.Request) (*plugin.Response, error) {
+	queryParams := p.linksQuery(req, "linkshere", "glh")
+	if !req.Filter.KeepRedirects {
+		queryParams.Set("glhshow", "!redirect")
+	}
 
-	return queue.Config{
-		Delay:     time.Millisecond * time.Duration(delayInMs),
-		QueueSize: uint(queueSize),
+	linksResponse, pages, err := p.query(queryParams)
+	if err != nil {
+		return nil, err
 	}
+
+	return buildResponse(req, linkedTitles(req, linksResponse, pages), encodeCursor(linksResponse.Continue)), nil
+}
+
+func (p *WikipediaPlugin) GetQueueConfig() queue.Config {
+	return p.queueConfig
 }
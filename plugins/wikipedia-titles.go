@@ -0,0 +1,137 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/malcolmmadsheep/handshakes-seeker/pkg/plugin"
+)
+
+// articlePathPrefix starts the path of article urls of MediaWiki sites.
+const articlePathPrefix = "/wiki/"
+
+// titleFromUrl extracts the page title from an article url, e.g.
+// https://en.wikipedia.org/wiki/Albert_Einstein#Life, or from an index.php
+// url with a title parameter. Anything else is taken for a title, possibly
+// percent-encoded.
+func titleFromUrl(rawUrl string) string {
+	pageUrl, err := url.Parse(rawUrl)
+	// Titles with a namespace, e.g. Category:Physics, parse as urls without
+	// a host.
+	if err != nil || pageUrl.Host == "" {
+		title := rawUrl
+		if i := strings.IndexByte(title, '#'); i >= 0 {
+			title = title[:i]
+		}
+		if unescaped, err := url.PathUnescape(title); err == nil {
+			title = unescaped
+		}
+
+		return title
+	}
+
+	if title := pageUrl.Query().Get("title"); title != "" {
+		return title
+	}
+	if i := strings.Index(pageUrl.Path, articlePathPrefix); i >= 0 {
+		return pageUrl.Path[i+len(articlePathPrefix):]
+	}
+
+	return path.Base(pageUrl.Path)
+}
+
+// normalizeTitle turns underscores into spaces, collapses whitespace and
+// capitalises the first letter unless titles are case sensitive.
+func normalizeTitle(title string, caseSensitive bool) string {
+	title = strings.Join(strings.Fields(strings.ReplaceAll(title, "_", " ")), " ")
+	if caseSensitive || title == "" {
+		return title
+	}
+
+	first, size := utf8.DecodeRuneInString(title)
+
+	return string(unicode.ToUpper(first)) + title[size:]
+}
+
+// Normalize turns an article url or a title into the title of the page as
+// the site would name it. Redirects are left to Resolve, so no request is
+// made.
+func (p *WikipediaPlugin) Normalize(rawUrl string) (string, error) {
+	title := normalizeTitle(titleFromUrl(rawUrl), p.caseSensitive)
+	if title == "" {
+		return "", plugin.Permanent(errors.New("empty title"))
+	}
+
+	return title, nil
+}
+
+// maxResolveTitles is the number of titles the API accepts in a single query.
+const maxResolveTitles = 50
+
+// Resolve looks titles up with a single query, which applies the title rules
+// of the site and follows redirects.
+func (p *WikipediaPlugin) Resolve(titles []string) ([]string, error) {
+	if len(titles) > maxResolveTitles {
+		return nil, plugin.Permanent(fmt.Errorf("can't resolve more than %d titles at once", maxResolveTitles))
+	}
+
+	queryParams := url.Values{
+		"action":    {"query"},
+		"format":    {"json"},
+		"redirects": {"1"},
+		"titles":    {strings.Join(titles, "|")},
+	}
+
+	linksResponse, pages, err := p.query(queryParams)
+	if err != nil {
+		return nil, err
+	}
+
+	renames := make(map[string]string)
+	for _, rename := range linksResponse.Query.Normalized {
+		renames[rename.From] = rename.To
+	}
+	redirects := make(map[string]string)
+	for _, redirect := range linksResponse.Query.Redirects {
+		redirects[redirect.From] = redirect.To
+	}
+	pagesByTitle := make(map[string]Page, len(pages))
+	for _, page := range pages {
+		pagesByTitle[page.Title] = page
+	}
+
+	resolved := make([]string, 0, len(titles))
+	notFound := make([]string, 0)
+
+	for _, title := range titles {
+		canonical := title
+		if to, contains := renames[canonical]; contains {
+			canonical = to
+		}
+		if to, contains := redirects[canonical]; contains {
+			canonical = to
+		}
+
+		page, contains := pagesByTitle[canonical]
+		if contains && page.InvalidReason != "" {
+			return nil, plugin.Permanent(fmt.Errorf("invalid title %s: %s", title, page.InvalidReason))
+		}
+		// Titles linking to other wikis have no page.
+		if !contains || page.Missing != nil {
+			notFound = append(notFound, title)
+		}
+
+		resolved = append(resolved, canonical)
+	}
+
+	if len(notFound) > 0 {
+		return nil, &plugin.NotFoundError{Nodes: notFound}
+	}
+
+	return resolved, nil
+}